@@ -0,0 +1,55 @@
+package cryptowrap
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// ErrNotAuthenticated might be returned in case of associated data or timestamps provided for the cipher
+// (or the data produced by the previous versions) which could not authenticate them.
+var ErrNotAuthenticated = errors.New("associated data could not be authenticated with the cipher")
+
+// EncryptionContext returns the canonical form of the key/value encryption context
+// to be used as AssociatedData. The result does not depend on the map iteration order.
+func EncryptionContext(ctx map[string]string) []byte {
+	keys := make([]string, 0, len(ctx))
+	for k := range ctx {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var buf []byte
+
+	for _, k := range keys {
+		buf = binary.AppendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = binary.AppendUvarint(buf, uint64(len(ctx[k])))
+		buf = append(buf, ctx[k]...)
+	}
+
+	return buf
+}
+
+// authenticated reports the cipher authenticates the additional data.
+func (c Cipher) authenticated() bool {
+	return c != CipherAESCBC && c != cipherRSAOAEP
+}
+
+// bind returns the additional data to be authenticated by the cipher:
+// canonical form of the header followed by the associated data provided.
+// Variable-length header fields are length-prefixed and bounded by validate,
+// so the canonical form is self-delimiting and the concatenation is unambiguous.
+func (h *header) bind(associatedData []byte) []byte {
+	return append(h.additionalData(), associatedData...)
+}
+
+// checkAssociatedData returns ErrNotAuthenticated if associated data provided could not be authenticated by the cipher.
+func checkAssociatedData(c Cipher, associatedData []byte) error {
+	if len(associatedData) > 0 && !c.authenticated() {
+		return ErrNotAuthenticated
+	}
+
+	return nil
+}
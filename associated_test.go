@@ -0,0 +1,121 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestEncryptionContext(t *testing.T) {
+	a := cryptowrap.EncryptionContext(map[string]string{"table": "users", "id": "42"})
+	b := cryptowrap.EncryptionContext(map[string]string{"id": "42", "table": "users"})
+
+	if !bytes.Equal(a, b) {
+		t.Error("context is not canonical")
+	}
+
+	c := cryptowrap.EncryptionContext(map[string]string{"id": "4", "table": "2users"})
+	if bytes.Equal(a, c) {
+		t.Error("context is ambiguous")
+	}
+}
+
+func TestWrapperAssociatedDataJSON(t *testing.T) {
+	testWrapperAssociatedData(t, cryptowrap.CipherAESGCM, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperAssociatedDataCBCHMACMsgp(t *testing.T) {
+	testWrapperAssociatedData(t, cryptowrap.CipherAESCBCHMAC, binMarshal, binUnmarshal)
+}
+
+func testWrapperAssociatedData(
+	t *testing.T,
+	c cryptowrap.Cipher,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(32)}
+	orig := TestData{Field1: "Field1"}
+	userA := cryptowrap.EncryptionContext(map[string]string{"user": "A"})
+	userB := cryptowrap.EncryptionContext(map[string]string{"user": "B"})
+
+	data, err := marshaler(&cryptowrap.Wrapper{Keys: keys, Payload: &orig, Cipher: c, AssociatedData: userA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, AssociatedData: userA}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, AssociatedData: userB})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperAssociatedDataNotAuthenticated(t *testing.T) {
+	keys := [][]byte{randBytes(16)}
+
+	_, err := json.Marshal(&cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, AssociatedData: []byte("A")})
+	if !errors.Is(err, cryptowrap.ErrNotAuthenticated) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, AssociatedData: []byte("A")})
+	if !errors.Is(err, cryptowrap.ErrNotAuthenticated) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperRSAAssociatedData(t *testing.T) {
+	initKeys.Do(testKeysInit)
+
+	orig := TestData{Field1: "Field1"}
+
+	data, err := json.Marshal(&cryptowrap.WrapperRSA{
+		EncKey:         &testKeys2048[0].PublicKey,
+		Payload:        &orig,
+		AssociatedData: []byte("A"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.WrapperRSA{DecKeys: testKeys2048, Payload: &TestData{}, AssociatedData: []byte("A")}
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.WrapperRSA{DecKeys: testKeys2048, Payload: &TestData{}, AssociatedData: []byte("B")})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
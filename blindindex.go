@@ -0,0 +1,169 @@
+package cryptowrap
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// blindIndexSize is the default length of the blind index.
+const blindIndexSize = 16
+
+var blindIndexInfo = []byte("cryptowrap blind index key") // nolint: gochecknoglobals
+
+// ErrInvalidIndexSize might be returned in case of BlindIndex Size is out of range.
+var ErrInvalidIndexSize = errors.New("invalid blind index size")
+
+// Normalizer transforms the value before the blind index calculated,
+// so the values equal after normalization produce the same index.
+type Normalizer func(string) string
+
+// NormalizeLowercase is a Normalizer making the value lower case.
+func NormalizeLowercase(s string) string {
+	return strings.ToLower(s)
+}
+
+// NormalizeTrim is a Normalizer removing leading and trailing white space.
+func NormalizeTrim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+// NormalizeAll returns the Normalizer applying the normalizers provided one by one.
+func NormalizeAll(normalizers ...Normalizer) Normalizer {
+	return func(s string) string {
+		for _, normalize := range normalizers {
+			s = normalize(s)
+		}
+
+		return s
+	}
+}
+
+// BlindIndex is a struct with custom JSON/Gob/Binary marshaler and unmarshaler
+// producing a keyed hash (blind index) of the Value to be stored alongside the encrypted field
+// and queried by exact match.
+//
+// Index is HMAC-SHA256 of the Value truncated to Size bytes (16 by default, 32 at most).
+// Shorter index produces more false positives on lookup but leaks less about the Value.
+//
+// Index key is derived from the first value of Keys or the primary key of KeyRing,
+// so the same key set could be used for Wrapper and BlindIndex but the keys are never used for both.
+//
+// Normalizer is applied to the Value before hashing,
+// e.g. NormalizeAll(NormalizeTrim, NormalizeLowercase) for emails.
+//
+// Context separates the indexes of the different fields, e.g. the column name,
+// so the same values in the different fields produce unrelated indexes.
+//
+// Marshaler stores the index only, Value could not be recovered.
+// Unmarshaler fills Index with the index stored.
+type BlindIndex struct {
+	Keys       [][]byte
+	KeyRing    *KeyRing
+	Value      string
+	Size       int
+	Normalizer Normalizer
+	Context    []byte
+	Index      []byte
+}
+
+// Sum returns the blind index of the Value calculated with the primary key.
+func (b *BlindIndex) Sum() ([]byte, error) {
+	keys, err := symmetricKeys(b.Keys, nil, b.KeyRing)
+	if err != nil {
+		return nil, err
+	}
+
+	if !keys.primary {
+		return nil, ErrNoPrimaryKey
+	}
+
+	return b.sum(keys.keys[0])
+}
+
+// Sums returns the blind indexes of the Value calculated with all the keys, primary one first.
+// Query all of them to find the data indexed before key rotation.
+func (b *BlindIndex) Sums() ([][]byte, error) {
+	keys, err := symmetricKeys(b.Keys, nil, b.KeyRing)
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make([][]byte, 0, len(keys.keys))
+
+	for _, key := range keys.keys {
+		sum, err := b.sum(key)
+		if err != nil {
+			return nil, err
+		}
+
+		sums = append(sums, sum)
+	}
+
+	return sums, nil
+}
+
+// MarshalJSON is a custom marshaler.
+func (b *BlindIndex) MarshalJSON() ([]byte, error) {
+	sum, err := b.Sum()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(sum)
+}
+
+// UnmarshalJSON is a custom unmarshaler.
+func (b *BlindIndex) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &b.Index)
+}
+
+// GobEncode is a custom marshaler.
+func (b *BlindIndex) GobEncode() ([]byte, error) {
+	return b.Sum()
+}
+
+// GobDecode is a custom unmarshaler.
+func (b *BlindIndex) GobDecode(data []byte) error {
+	b.Index = append([]byte(nil), data...)
+
+	return nil
+}
+
+// MarshalBinary is a custom marshaler to be used with MsgPack (github.com/ugorji/go/codec).
+func (b *BlindIndex) MarshalBinary() ([]byte, error) {
+	return b.Sum()
+}
+
+// UnmarshalBinary is a custom unmarshaler to be used with MsgPack (github.com/ugorji/go/codec).
+func (b *BlindIndex) UnmarshalBinary(data []byte) error {
+	b.Index = append([]byte(nil), data...)
+
+	return nil
+}
+
+func (b *BlindIndex) sum(key []byte) ([]byte, error) {
+	size := b.Size
+	if size == 0 {
+		size = blindIndexSize
+	}
+
+	if size < 0 || size > sha256.Size {
+		return nil, ErrInvalidIndexSize
+	}
+
+	value := b.Value
+	if b.Normalizer != nil {
+		value = b.Normalizer(value)
+	}
+
+	mac := hmac.New(sha256.New, deriveKey(key, blindIndexInfo))
+	mac.Write(binary.AppendUvarint(nil, uint64(len(b.Context)))) // nolint: errcheck
+	mac.Write(b.Context)                                         // nolint: errcheck
+	mac.Write([]byte(value))                                     // nolint: errcheck
+
+	return mac.Sum(nil)[:size], nil
+}
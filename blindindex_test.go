@@ -0,0 +1,150 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+type indexedRecord struct {
+	Email      *cryptowrap.Wrapper
+	EmailIndex *cryptowrap.BlindIndex
+}
+
+func TestBlindIndexJSON(t *testing.T) {
+	testBlindIndex(t, json.Marshal, json.Unmarshal)
+}
+
+func TestBlindIndexGob(t *testing.T) {
+	testBlindIndex(t, gobMarshal, gobUnmarshal)
+}
+
+func TestBlindIndexMsgp(t *testing.T) {
+	testBlindIndex(t, binMarshal, binUnmarshal)
+}
+
+func testBlindIndex(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(32)}
+	normalizer := cryptowrap.NormalizeAll(cryptowrap.NormalizeTrim, cryptowrap.NormalizeLowercase)
+	email := "User@Example.com"
+
+	data, err := marshaler(&indexedRecord{
+		Email: &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{Field1: email}, Cipher: cryptowrap.CipherAESGCM},
+		EmailIndex: &cryptowrap.BlindIndex{
+			Keys:       keys,
+			Value:      email,
+			Normalizer: normalizer,
+			Context:    []byte("email"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := indexedRecord{
+		Email:      &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}},
+		EmailIndex: &cryptowrap.BlindIndex{},
+	}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.Email.Payload.(*TestData).Field1 != email {
+		t.Error("decrypted is not equal to original")
+	}
+
+	query := cryptowrap.BlindIndex{
+		Keys:       keys,
+		Value:      "  user@example.COM ",
+		Normalizer: normalizer,
+		Context:    []byte("email"),
+	}
+
+	sum, err := query.Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(sum, dst.EmailIndex.Index) || len(sum) != 16 {
+		t.Errorf("index mismatch: %x != %x", sum, dst.EmailIndex.Index)
+	}
+}
+
+func TestBlindIndexSeparation(t *testing.T) {
+	keys := [][]byte{randBytes(32)}
+
+	sum := func(b cryptowrap.BlindIndex) []byte {
+		b.Keys = keys
+
+		s, err := b.Sum()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+
+	base := sum(cryptowrap.BlindIndex{Value: "value"})
+
+	if bytes.Equal(base, sum(cryptowrap.BlindIndex{Value: "Value"})) {
+		t.Error("different values produced the same index")
+	}
+
+	if bytes.Equal(base, sum(cryptowrap.BlindIndex{Value: "value", Context: []byte("column")})) {
+		t.Error("different contexts produced the same index")
+	}
+
+	if short := sum(cryptowrap.BlindIndex{Value: "value", Size: 4}); !bytes.Equal(short, base[:4]) {
+		t.Error("truncated index is not a prefix of the full one")
+	}
+
+	if bytes.Equal(base, cryptowrap.KeyFingerprint(keys[0])[:8]) {
+		t.Error("index is not separated from the key fingerprint")
+	}
+
+	_, err := (&cryptowrap.BlindIndex{Keys: keys, Value: "value", Size: 33}).Sum()
+	if !errors.Is(err, cryptowrap.ErrInvalidIndexSize) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = (&cryptowrap.BlindIndex{Value: "value"}).Sum()
+	if !errors.Is(err, cryptowrap.ErrNoKey) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBlindIndexKeyRing(t *testing.T) {
+	ring, err := cryptowrap.NewKeyRing(
+		cryptowrap.KeyEntry{ID: "k1", State: cryptowrap.KeyPrimary, Secret: randBytes(32)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := (&cryptowrap.BlindIndex{KeyRing: ring, Value: "value"}).Sum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ring.Add("k2", randBytes(32), cryptowrap.KeyPrimary); err != nil {
+		t.Fatal(err)
+	}
+
+	sums, err := (&cryptowrap.BlindIndex{KeyRing: ring, Value: "value"}).Sums()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sums) != 2 || bytes.Equal(sums[0], old) || !bytes.Equal(sums[1], old) {
+		t.Error("unexpected indexes after key rotation")
+	}
+}
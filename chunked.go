@@ -0,0 +1,278 @@
+package cryptowrap
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// wrapperChunkSize is the default length of the payload chunk encrypted by Wrapper in parallel.
+const wrapperChunkSize = 1 << 20
+
+// ErrNotAEAD is returned if Parallelism is set for the cipher other than AEAD.
+var ErrNotAEAD = errors.New("chunked encryption requires AEAD cipher")
+
+// chunkedPayload is the payload split to the chunks encrypted independently.
+type chunkedPayload struct {
+	Commitment []byte
+	Chunks     [][]byte
+}
+
+// sealChunks splits the serialized payload to the chunks and compresses, pads and encrypts them in parallel.
+// Chunks are encrypted with the STREAM construction keyed with the key and IV, so their order and count are authenticated.
+func (w *Wrapper) sealChunks(
+	h *header,
+	payload, key, iv []byte,
+	marshaler func(interface{}) ([]byte, error),
+) ([]byte, error) {
+	var (
+		chunked chunkedPayload
+		err     error
+	)
+
+	if h.Flags&flagCommitted != 0 {
+		chunked.Commitment, key, err = commitKeys(key, iv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sc, err := newStreamCipher(h.Cipher, key, iv, h.bind(w.AssociatedData))
+	if err != nil {
+		return nil, err
+	}
+
+	size, n, err := w.chunkCount(len(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	chunked.Chunks = make([][]byte, n)
+
+	err = parallel(n, w.Parallelism, func(i int) error {
+		chunk, err := w.sealChunk(sc, payload[i*size:min((i+1)*size, len(payload))], i, n)
+		if err != nil {
+			return err
+		}
+
+		chunked.Chunks[i] = chunk
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := marshaler(&chunked)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling chunks: %w", err)
+	}
+
+	return data, nil
+}
+
+// chunkCount returns the chunk size and the number of the chunks for the payload of length provided.
+// Empty payload is sealed as a single empty chunk.
+func (w *Wrapper) chunkCount(length int) (int, int, error) {
+	size := w.ChunkSize
+	if size <= 0 {
+		size = wrapperChunkSize
+	}
+
+	n := (length + size - 1) / size
+	if n == 0 {
+		n = 1
+	}
+
+	if uint64(n) > math.MaxUint32 {
+		return 0, 0, ErrStreamTooLong
+	}
+
+	return size, n, nil
+}
+
+// sealChunk compresses, pads and encrypts the i-th chunk of n.
+func (w *Wrapper) sealChunk(sc *streamCipher, chunk []byte, i, n int) ([]byte, error) {
+	if w.Compress {
+		compressed, err := compress(chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		chunk = compressed
+	}
+
+	if w.Padding != nil {
+		chunk = pad(chunk, w.Padding)
+	}
+
+	return sc.seal(nil, chunk, uint32(i), i == n-1), nil
+}
+
+// openChunks decrypts, unpads and decompresses the chunks in parallel and reassembles the serialized payload.
+// First chunk is decrypted before the others, so ErrUndecryptable is returned at once if the key is not suitable.
+func (w *Wrapper) openChunks(
+	h *header,
+	extW *externalWrapper,
+	key []byte,
+	unmarshaler func([]byte, interface{}) error,
+) ([]byte, error) {
+	chunked := chunkedPayload{}
+
+	err := unmarshaler(extW.Payload, &chunked)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling chunks: %w", err)
+	}
+
+	if len(chunked.Chunks) == 0 || uint64(len(chunked.Chunks)) > math.MaxUint32 {
+		return nil, ErrUndecryptable
+	}
+
+	key, err = openCommitment(h, key, extW.IV, chunked.Commitment)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := newStreamCipher(h.Cipher, key, extW.IV, h.bind(w.AssociatedData))
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(chunked.Chunks)
+	plain := make([][]byte, n)
+
+	open := func(i int) (err error) {
+		plain[i], err = openChunk(h, sc, chunked.Chunks[i], i, n)
+
+		return err
+	}
+
+	if err = open(0); err != nil {
+		return nil, err
+	}
+
+	err = parallel(n-1, w.workers(), func(i int) error { return open(i + 1) })
+	if err != nil {
+		return nil, err
+	}
+
+	return concatChunks(plain), nil
+}
+
+// openCommitment verifies the key commitment of the committed data
+// and returns the encryption key derived, the key provided is returned as is otherwise.
+// ErrUndecryptable is returned if the commitment does not match the key.
+func openCommitment(h *header, key, iv, commitment []byte) ([]byte, error) {
+	if h.Flags&flagCommitted == 0 {
+		return key, nil
+	}
+
+	expected, encKey, err := commitKeys(key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(expected, commitment) {
+		return nil, ErrUndecryptable
+	}
+
+	return encKey, nil
+}
+
+// openChunk decrypts, unpads and decompresses the i-th chunk of n.
+func openChunk(h *header, sc *streamCipher, chunk []byte, i, n int) ([]byte, error) {
+	chunk, err := sc.open(nil, chunk, uint32(i), i == n-1)
+	if err != nil {
+		return nil, ErrUndecryptable
+	}
+
+	if h.Flags&flagPadded != 0 {
+		chunk, err = unpad(chunk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if h.Compression == CompressionLZ4 {
+		chunk, err = decompress(chunk)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return chunk, nil
+}
+
+// concatChunks reassembles the payload from the chunks decrypted.
+func concatChunks(chunks [][]byte) []byte {
+	size := 0
+	for _, chunk := range chunks {
+		size += len(chunk)
+	}
+
+	payload := make([]byte, 0, size)
+	for _, chunk := range chunks {
+		payload = append(payload, chunk...)
+	}
+
+	return payload
+}
+
+// workers returns the number of the workers to decrypt the chunks.
+func (w *Wrapper) workers() int {
+	if w.Parallelism > 0 {
+		return w.Parallelism
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+// parallel calls fn for 0..n-1 by the workers concurrently and returns the first error occurred.
+// Remaining calls are skipped after the error.
+func parallel(n, workers int, fn func(i int) error) error {
+	if workers > n {
+		workers = n
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		next    int64 = -1
+		failed  int32
+		errOnce sync.Once
+		err     error
+		wg      sync.WaitGroup
+	)
+
+	wg.Add(workers)
+
+	for j := 0; j < workers; j++ {
+		go func() {
+			defer wg.Done()
+
+			for atomic.LoadInt32(&failed) == 0 {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+
+				if e := fn(i); e != nil {
+					errOnce.Do(func() { err = e })
+					atomic.StoreInt32(&failed, 1)
+
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return err
+}
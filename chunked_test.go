@@ -0,0 +1,147 @@
+package cryptowrap_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperChunkedJSON(t *testing.T) {
+	testWrapperChunked(t, &cryptowrap.Wrapper{Cipher: cryptowrap.CipherAESGCM}, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperChunkedGobCompress(t *testing.T) {
+	testWrapperChunked(t, &cryptowrap.Wrapper{Cipher: cryptowrap.CipherChaCha20Poly1305, Compress: true}, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperChunkedMsgpPaddedCommitted(t *testing.T) {
+	testWrapperChunked(
+		t,
+		&cryptowrap.Wrapper{
+			Cipher:   cryptowrap.CipherXChaCha20Poly1305,
+			Compress: true,
+			Padding:  cryptowrap.PadPowerOfTwo(),
+			Commit:   true,
+		},
+		binMarshal,
+		binUnmarshal,
+	)
+}
+
+func TestWrapperChunkedDeterministic(t *testing.T) {
+	testWrapperChunked(t, &cryptowrap.Wrapper{Cipher: cryptowrap.CipherAESSIV, Deterministic: true}, json.Marshal, json.Unmarshal)
+}
+
+func testWrapperChunked(
+	t *testing.T,
+	src *cryptowrap.Wrapper,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(32), randBytes(32)}
+	orig := TestData{Field1: "Field1", Field3: hex.EncodeToString(randBytes(10000))}
+
+	src.Keys = keys[1:]
+	src.Payload = &orig
+	src.Parallelism = 4
+	src.ChunkSize = 1000
+
+	data, err := marshaler(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) || dst.KeyIndex() != 1 {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys[:1], Payload: &TestData{}, Parallelism: 2})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperChunkedTampered(t *testing.T) {
+	keys := [][]byte{randBytes(16)}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{
+		Keys:        keys,
+		Payload:     &TestData{Field3: hex.EncodeToString(randBytes(1000))},
+		Cipher:      cryptowrap.CipherAESGCM,
+		Parallelism: 2,
+		ChunkSize:   100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		extW struct {
+			Header     json.RawMessage
+			WrappedKey []byte
+			IV         []byte
+			Payload    []byte
+		}
+		chunked struct {
+			Commitment []byte
+			Chunks     [][]byte
+		}
+	)
+
+	if err = json.Unmarshal(data, &extW); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = json.Unmarshal(extW.Payload, &chunked); err != nil {
+		t.Fatal(err)
+	}
+
+	original := chunked.Chunks
+
+	for name, chunks := range map[string][][]byte{
+		"reordered": append([][]byte{original[1], original[0]}, original[2:]...),
+		"dropped":   original[:len(original)-1],
+		"appended":  append(append([][]byte(nil), original...), original[0]),
+	} {
+		chunked.Chunks = chunks
+
+		if extW.Payload, err = json.Marshal(&chunked); err != nil {
+			t.Fatal(err)
+		}
+
+		tampered, err := json.Marshal(&extW)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = json.Unmarshal(tampered, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+		if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
+
+func TestWrapperChunkedNegative(t *testing.T) {
+	for _, c := range []cryptowrap.Cipher{cryptowrap.CipherAESCBC, cryptowrap.CipherAESCBCHMAC} {
+		_, err := json.Marshal(&cryptowrap.Wrapper{
+			Keys:        [][]byte{randBytes(32)},
+			Payload:     &TestData{},
+			Cipher:      c,
+			Parallelism: 2,
+		})
+		if !errors.Is(err, cryptowrap.ErrNotAEAD) {
+			t.Errorf("cipher %d: unexpected error: %v", c, err)
+		}
+	}
+}
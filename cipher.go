@@ -0,0 +1,139 @@
+package cryptowrap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+
+	aescrypt "github.com/Djarvur/go-aescrypt"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Cipher is an identifier of the encryption algorithm used by Wrapper.
+type Cipher uint8
+
+// Ciphers supported.
+const (
+	// CipherAESCBC is AES in CBC mode with PKCS#7 padding.
+	// Default one, integrity is protected by checksum only.
+	CipherAESCBC Cipher = iota
+	// CipherAESGCM is AES in GCM mode with 96-bit random nonce.
+	// Ciphertext is authenticated.
+	CipherAESGCM
+	// CipherChaCha20Poly1305 is ChaCha20-Poly1305 AEAD with 96-bit random nonce.
+	// Key must be 32 bytes long. Faster than AES on CPUs without AES instructions.
+	CipherChaCha20Poly1305
+	// CipherXChaCha20Poly1305 is XChaCha20-Poly1305 AEAD with 192-bit random nonce.
+	// Key must be 32 bytes long. Nonce is long enough to be generated randomly for any volume of messages.
+	CipherXChaCha20Poly1305
+	// CipherAESCBCHMAC is AES in CBC mode with PKCS#7 padding and HMAC-SHA256 (encrypt-then-MAC).
+	// MAC key is derived from the key. MAC is verified in constant time before any decryption attempted.
+	// For those who have to stay with CBC.
+	CipherAESCBCHMAC
+	// CipherAESSIV is AES-SIV (RFC 5297) deterministic AEAD with optional 128-bit nonce.
+	// Key must be 32, 48 or 64 bytes long (double length AES key). Misuse-resistant: nonce reuse leaks equality only.
+	CipherAESSIV
+	// CipherAESGCMSIV is AES-GCM-SIV (RFC 8452) nonce misuse-resistant AEAD with 96-bit nonce.
+	// Key must be 16 or 32 bytes long. IV reuse reveals equality of the messages only, not the key stream.
+	CipherAESGCMSIV
+)
+
+// Errors might be returned by the ciphers.
+var (
+	ErrUnknownCipher       = errors.New("unknown cipher")
+	ErrInvalidIV           = errors.New("invalid IV length")
+	ErrUnauthenticatedData = errors.New("unauthenticated data is not accepted")
+)
+
+// ivSize returns the IV (nonce) length expected by the cipher.
+func (c Cipher) ivSize() (int, error) {
+	switch c {
+	case CipherAESCBC, CipherAESCBCHMAC, CipherAESSIV:
+		return aes.BlockSize, nil
+	case CipherAESGCM, CipherChaCha20Poly1305:
+		return 12, nil // nolint: gomnd
+	case CipherAESGCMSIV:
+		return gcmSIVNonceSize, nil
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NonceSizeX, nil
+	default:
+		return 0, fmt.Errorf("%w: %d", ErrUnknownCipher, c)
+	}
+}
+
+// encrypt encrypts the data. additionalData is authenticated by all the ciphers but plain AES-CBC.
+func (c Cipher) encrypt(data, key, iv, additionalData []byte) ([]byte, error) {
+	if !c.isAEAD() && len(iv) != aes.BlockSize {
+		return nil, ErrInvalidIV
+	}
+
+	switch c {
+	case CipherAESCBC:
+		return aescrypt.EncryptAESCBCPadded(data, key, iv)
+	case CipherAESCBCHMAC:
+		return encryptCBCHMAC(data, key, iv, additionalData)
+	}
+
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := aead.NonceSize(); n > 0 && len(iv) != n {
+		return nil, ErrInvalidIV
+	}
+
+	return aead.Seal(nil, iv, data, additionalData), nil
+}
+
+func (c Cipher) decrypt(data, key, iv, additionalData []byte) ([]byte, error) {
+	if !c.isAEAD() && len(iv) != aes.BlockSize {
+		return nil, ErrInvalidIV
+	}
+
+	switch c {
+	case CipherAESCBC:
+		return aescrypt.DecryptAESCBCPadded(data, key, iv)
+	case CipherAESCBCHMAC:
+		return decryptCBCHMAC(data, key, iv, additionalData)
+	}
+
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := aead.NonceSize(); n > 0 && len(iv) != n {
+		return nil, ErrInvalidIV
+	}
+
+	return aead.Open(nil, iv, data, additionalData)
+}
+
+// isAEAD reports the cipher is AEAD, so it could be used to encrypt the chunks.
+func (c Cipher) isAEAD() bool {
+	return c != CipherAESCBC && c != CipherAESCBCHMAC
+}
+
+func (c Cipher) aead(key []byte) (cipher.AEAD, error) {
+	switch c {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		return cipher.NewGCM(block)
+	case CipherChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	case CipherAESSIV:
+		return NewSIV(key)
+	case CipherAESGCMSIV:
+		return NewGCMSIV(key)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCipher, c)
+	}
+}
@@ -0,0 +1,179 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperGCMJSON128(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESGCM, 16, false, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperGCMJSON256Compress(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESGCM, 32, true, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperGCMGob256(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESGCM, 32, false, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperGCMMsgp128(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESGCM, 16, false, binMarshal, binUnmarshal)
+}
+
+func TestWrapperGCMCBOR256Compress(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESGCM, 32, true, cborMarshal, cborUnmarshal)
+}
+
+func TestWrapperGCMNegative(t *testing.T) {
+	key := randBytes(16)
+	orig := TestData{Field1: "Field1"}
+
+	_, err := json.Marshal(&cryptowrap.Wrapper{
+		Keys:    [][]byte{key},
+		IV:      randBytes(16),
+		Payload: &orig,
+		Cipher:  cryptowrap.CipherAESGCM,
+	})
+	if !errors.Is(err, cryptowrap.ErrInvalidIV) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = json.Marshal(&cryptowrap.Wrapper{
+		Keys:    [][]byte{key},
+		Payload: &orig,
+		Cipher:  cryptowrap.Cipher(255),
+	})
+	if !errors.Is(err, cryptowrap.ErrUnknownCipher) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = json.Marshal(&cryptowrap.Wrapper{
+		Keys:    [][]byte{key},
+		Payload: &orig,
+		Cipher:  cryptowrap.CipherXChaCha20Poly1305,
+	})
+	if err == nil {
+		t.Error("encrypted with a short key")
+	}
+}
+
+func testWrapperCipher(
+	t *testing.T,
+	c cryptowrap.Cipher,
+	keyLen int,
+	compress bool,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{
+		randBytes(keyLen),
+		randBytes(keyLen),
+	}
+
+	orig := TestData{
+		Field1: "Field1",
+		Field2: "Field2",
+		Field3: "                                                  ",
+	}
+
+	data, err := marshaler(&cryptowrap.Wrapper{
+		Keys:     keys[1:],
+		Payload:  &orig,
+		Compress: compress,
+		Cipher:   c,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.Wrapper{
+		Keys:    keys,
+		Payload: &TestData{},
+	}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys[:1], Payload: &TestData{}})
+	if err == nil {
+		t.Error("decrypted undecryptable")
+	}
+}
+
+func TestWrapperChaCha20Poly1305JSON(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherChaCha20Poly1305, 32, false, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperChaCha20Poly1305MsgpCompress(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherChaCha20Poly1305, 32, true, binMarshal, binUnmarshal)
+}
+
+func TestWrapperXChaCha20Poly1305Gob(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherXChaCha20Poly1305, 32, false, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperXChaCha20Poly1305CBORCompress(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherXChaCha20Poly1305, 32, true, cborMarshal, cborUnmarshal)
+}
+
+func TestWrapperCBCHMACJSON128(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESCBCHMAC, 16, false, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperCBCHMACGob256Compress(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESCBCHMAC, 32, true, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperCBCHMACMsgp192(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESCBCHMAC, 24, false, binMarshal, binUnmarshal)
+}
+
+func TestWrapperCBCHMACTampered(t *testing.T) {
+	key := randBytes(16)
+
+	src := cryptowrap.Wrapper{
+		Keys:    [][]byte{key},
+		Payload: &TestData{Field1: "Field1"},
+		Cipher:  cryptowrap.CipherAESCBCHMAC,
+	}
+
+	data, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := len(data) - 64; i < len(data); i += 8 {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 1
+
+		err = (&cryptowrap.Wrapper{Keys: [][]byte{key}, Payload: &TestData{}}).UnmarshalBinary(tampered)
+		if err == nil {
+			t.Errorf("decrypted tampered data, byte %d", i)
+		}
+	}
+}
+
+func TestWrapperCBCInvalidIV(t *testing.T) {
+	for _, c := range []cryptowrap.Cipher{cryptowrap.CipherAESCBC, cryptowrap.CipherAESCBCHMAC} {
+		_, err := json.Marshal(&cryptowrap.Wrapper{
+			Keys:    [][]byte{randBytes(16)},
+			IV:      randBytes(12),
+			Payload: &TestData{},
+			Cipher:  c,
+		})
+		if !errors.Is(err, cryptowrap.ErrInvalidIV) {
+			t.Errorf("cipher %d: unexpected error: %v", c, err)
+		}
+	}
+}
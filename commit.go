@@ -0,0 +1,76 @@
+package cryptowrap
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// commitmentSize is the length of the key commitment.
+const commitmentSize = sha256.Size
+
+// ErrNotCommitted is returned if the data is not key-committing but Commit is requested by Unmarshaler.
+var ErrNotCommitted = errors.New("data is not key-committing")
+
+// nolint: gochecknoglobals
+var (
+	commitmentInfo = []byte("cryptowrap key commitment")
+	commitKeyInfo  = []byte("cryptowrap committed key")
+)
+
+// commitEncrypt encrypts the data with the subkey derived from the key and IV
+// and prepends the commitment to the key and IV to the ciphertext.
+//
+// Commitment is HMAC-SHA256 so it is infeasible to find two keys with the same commitment
+// and the ciphertext could be decrypted with the only key it has been produced with,
+// even if the cipher itself is not key-committing (GCM and Poly1305-based ones are not).
+func commitEncrypt(c Cipher, data, key, iv, additionalData []byte) ([]byte, error) {
+	commitment, subkey, err := commitKeys(key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := c.encrypt(data, subkey, iv, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(commitment, encrypted...), nil
+}
+
+// commitDecrypt verifies the commitment in constant time and decrypts the data if it is valid.
+func commitDecrypt(c Cipher, data, key, iv, additionalData []byte) ([]byte, error) {
+	if len(data) < commitmentSize {
+		return nil, ErrUndecryptable
+	}
+
+	commitment, subkey, err := commitKeys(key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(commitment, data[:commitmentSize]) {
+		return nil, ErrUndecryptable
+	}
+
+	return c.decrypt(data[commitmentSize:], subkey, iv, additionalData)
+}
+
+// commitKeys returns the commitment to the key and IV and the subkey of the same length as the key.
+func commitKeys(key, iv []byte) ([]byte, []byte, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(commitmentInfo) // nolint: errcheck
+	mac.Write(iv)             // nolint: errcheck
+
+	subkey := make([]byte, len(key))
+
+	_, err := io.ReadFull(hkdf.Expand(sha256.New, key, append(append([]byte(nil), commitKeyInfo...), iv...)), subkey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mac.Sum(nil), subkey, nil
+}
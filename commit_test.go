@@ -0,0 +1,107 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperCommitJSON(t *testing.T) {
+	testWrapperCommit(t, cryptowrap.CipherAESGCM, 16, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperCommitGob(t *testing.T) {
+	testWrapperCommit(t, cryptowrap.CipherChaCha20Poly1305, 32, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperCommitMsgp(t *testing.T) {
+	testWrapperCommit(t, cryptowrap.CipherXChaCha20Poly1305, 32, binMarshal, binUnmarshal)
+}
+
+func testWrapperCommit(
+	t *testing.T,
+	c cryptowrap.Cipher,
+	keyLen int,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(keyLen), randBytes(keyLen), randBytes(keyLen)}
+	orig := TestData{Field1: "Field1"}
+
+	data, err := marshaler(&cryptowrap.Wrapper{Keys: keys[2:], Payload: &orig, Cipher: c, Commit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) || dst.KeyIndex() != 2 {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys[:2], Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperCommitTampered(t *testing.T) {
+	keys := [][]byte{randBytes(16)}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{
+		Keys:    keys,
+		Payload: &TestData{},
+		Cipher:  cryptowrap.CipherAESGCM,
+		Commit:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope map[string]interface{}
+
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// drop the commitment flag: ciphertext could not be decrypted as a plain GCM one
+	envelope["Header"].(map[string]interface{})["Flags"] = 0
+
+	data, err = json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = json.Marshal(&cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Commit: true})
+	if !errors.Is(err, cryptowrap.ErrNotAuthenticated) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperCommitRequired(t *testing.T) {
+	keys := [][]byte{randBytes(16)}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Cipher: cryptowrap.CipherAESGCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Cipher: cryptowrap.CipherAESGCM, Commit: true})
+	if !errors.Is(err, cryptowrap.ErrNotCommitted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package cryptowrap
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+)
+
+// nolint: gochecknoglobals
+var (
+	convergentKeyInfo  = []byte("cryptowrap convergent key")
+	convergentWrapInfo = []byte("cryptowrap convergent wrap key")
+)
+
+// deterministic reports the envelope must have no random parts.
+func (w *Wrapper) deterministic() bool {
+	return w.Deterministic || w.Convergent
+}
+
+// convergentKey returns the content key for the payload and the content key wrapped with the tenant key.
+// Both are deterministic, header is authenticated by the wrapping.
+func convergentKey(tenantKey, payload []byte, h *header) ([]byte, []byte, error) {
+	key := contentKey(tenantKey, payload)
+
+	aead, err := NewSIV(tenantWrapKey(tenantKey))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, aead.Seal(nil, nil, key, h.additionalData()), nil
+}
+
+// unwrapContentKey unwraps the content key wrapped by convergentKey.
+func unwrapContentKey(tenantKey, wrapped []byte, h *header) ([]byte, error) {
+	aead, err := NewSIV(tenantWrapKey(tenantKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, nil, wrapped, h.additionalData())
+}
+
+// contentKey returns AES-256-SIV key derived from the serialized payload with the tenant key.
+func contentKey(tenantKey, payload []byte) []byte {
+	mac := hmac.New(sha512.New, deriveKey(tenantKey, convergentKeyInfo))
+	mac.Write(payload) // nolint: errcheck
+
+	return mac.Sum(nil)
+}
+
+// tenantWrapKey returns AES-256-SIV key derived from the tenant key to wrap the content keys.
+func tenantWrapKey(tenantKey []byte) []byte {
+	mac := hmac.New(sha512.New, tenantKey)
+	mac.Write(convergentWrapInfo) // nolint: errcheck
+
+	return mac.Sum(nil)
+}
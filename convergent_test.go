@@ -0,0 +1,92 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperConvergentJSON(t *testing.T) {
+	testWrapperConvergent(t, false, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperConvergentGobCompress(t *testing.T) {
+	testWrapperConvergent(t, true, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperConvergentMsgp(t *testing.T) {
+	testWrapperConvergent(t, false, binMarshal, binUnmarshal)
+}
+
+func testWrapperConvergent(
+	t *testing.T,
+	compress bool,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	tenants := [][]byte{randBytes(16), randBytes(32)}
+	attachment := TestData{Field1: "attachment.pdf", Field3: hex.EncodeToString(randBytes(512))}
+
+	encrypt := func(tenant []byte, payload *TestData) []byte {
+		data, err := marshaler(&cryptowrap.Wrapper{
+			Keys:       [][]byte{tenant},
+			Payload:    payload,
+			Compress:   compress,
+			Cipher:     cryptowrap.CipherAESSIV,
+			Convergent: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data
+	}
+
+	data := encrypt(tenants[1], &attachment)
+
+	copied := attachment
+	if !bytes.Equal(data, encrypt(tenants[1], &copied)) {
+		t.Error("same payload produced different data")
+	}
+
+	if bytes.Equal(data, encrypt(tenants[0], &attachment)) {
+		t.Error("different tenants produced the same data")
+	}
+
+	if bytes.Equal(data, encrypt(tenants[1], &TestData{Field1: "attachment.pdf"})) {
+		t.Error("different payloads produced the same data")
+	}
+
+	dst := cryptowrap.Wrapper{Keys: tenants, Payload: &TestData{}}
+
+	err := unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&attachment, dst.Payload) || dst.KeyIndex() != 1 {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: tenants[:1], Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperConvergentNegative(t *testing.T) {
+	_, err := json.Marshal(&cryptowrap.Wrapper{
+		Keys:       [][]byte{randBytes(32)},
+		Payload:    &TestData{},
+		Cipher:     cryptowrap.CipherAESGCM,
+		Convergent: true,
+	})
+	if !errors.Is(err, cryptowrap.ErrNotDeterministic) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
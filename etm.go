@@ -0,0 +1,62 @@
+package cryptowrap
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	aescrypt "github.com/Djarvur/go-aescrypt"
+)
+
+var macKeyInfo = []byte("cryptowrap cbc hmac key") // nolint: gochecknoglobals
+
+// encryptCBCHMAC encrypts the data with AES-CBC and appends HMAC-SHA256 of additional data, IV and ciphertext.
+// MAC key is derived from the key provided, the key itself is used for AES.
+func encryptCBCHMAC(data, key, iv, additionalData []byte) ([]byte, error) {
+	encrypted, err := aescrypt.EncryptAESCBCPadded(data, key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(encrypted, cbcMAC(key, iv, encrypted, additionalData)...), nil
+}
+
+// decryptCBCHMAC verifies the MAC in constant time and decrypts the data if and only if the MAC is valid,
+// so no decryption (and padding check) is attempted for the forged data.
+func decryptCBCHMAC(data, key, iv, additionalData []byte) ([]byte, error) {
+	if len(data) < sha256.Size {
+		return nil, ErrUndecryptable
+	}
+
+	encrypted, tag := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+
+	if !hmac.Equal(tag, cbcMAC(key, iv, encrypted, additionalData)) {
+		return nil, ErrUndecryptable
+	}
+
+	return aescrypt.DecryptAESCBCPadded(encrypted, key, iv)
+}
+
+// cbcMAC calculates HMAC-SHA256 of length-prefixed additional data, IV and ciphertext.
+func cbcMAC(key, iv, encrypted, additionalData []byte) []byte {
+	mac := hmac.New(sha256.New, deriveKey(key, macKeyInfo))
+
+	var length [8]byte
+
+	binary.BigEndian.PutUint64(length[:], uint64(len(additionalData)))
+
+	mac.Write(length[:])      // nolint: errcheck
+	mac.Write(additionalData) // nolint: errcheck
+	mac.Write(iv)             // nolint: errcheck
+	mac.Write(encrypted)      // nolint: errcheck
+
+	return mac.Sum(nil)
+}
+
+// deriveKey derives 32 bytes subkey from the key for the purpose described by info.
+func deriveKey(key, info []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(info) // nolint: errcheck
+
+	return mac.Sum(nil)
+}
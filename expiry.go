@@ -0,0 +1,86 @@
+package cryptowrap
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors might be returned in case of the data is out of its validity period.
+var (
+	ErrExpired     = errors.New("data has expired")
+	ErrNotYetValid = errors.New("data is not valid yet")
+)
+
+// now returns the current time from the Clock provided or time.Now.
+func (w *Wrapper) now() time.Time {
+	if w.Clock != nil {
+		return w.Clock()
+	}
+
+	return time.Now()
+}
+
+// stamp stores the timestamps to the header. Nothing is stored if no timestamps requested.
+// IssuedAt is not defaulted to the current time in deterministic mode unless TTL requested.
+func (w *Wrapper) stamp(h *header) {
+	if w.IssuedAt.IsZero() && w.NotBefore.IsZero() && w.ExpiresAt.IsZero() && w.TTL <= 0 {
+		return
+	}
+
+	now := w.now()
+
+	issuedAt := w.IssuedAt
+	if issuedAt.IsZero() && (!w.deterministic() || w.TTL > 0) {
+		issuedAt = now
+	}
+
+	expiresAt := w.ExpiresAt
+	if expiresAt.IsZero() && w.TTL > 0 {
+		expiresAt = issuedAt.Add(w.TTL)
+	}
+
+	h.IssuedAt = unixTime(issuedAt)
+	h.NotBefore = unixTime(w.NotBefore)
+	h.ExpiresAt = unixTime(expiresAt)
+}
+
+// checkTimestamps checks the validity period of the authenticated header
+// and fills the Wrapper timestamps from it.
+func (w *Wrapper) checkTimestamps(h *header) error {
+	w.IssuedAt = timeUnix(h.IssuedAt)
+	w.NotBefore = timeUnix(h.NotBefore)
+	w.ExpiresAt = timeUnix(h.ExpiresAt)
+
+	now := w.now()
+
+	if !w.ExpiresAt.IsZero() && !now.Before(w.ExpiresAt) {
+		return ErrExpired
+	}
+
+	if !w.NotBefore.IsZero() && now.Before(w.NotBefore) {
+		return ErrNotYetValid
+	}
+
+	return nil
+}
+
+// timestamped reports the header contains any of timestamps.
+func (h *header) timestamped() bool {
+	return h.IssuedAt != 0 || h.NotBefore != 0 || h.ExpiresAt != 0
+}
+
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+func timeUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,109 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperExpiryJSON(t *testing.T) {
+	testWrapperExpiry(t, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperExpiryGob(t *testing.T) {
+	testWrapperExpiry(t, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperExpiryMsgp(t *testing.T) {
+	testWrapperExpiry(t, binMarshal, binUnmarshal)
+}
+
+func testWrapperExpiry(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(16)}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	data, err := marshaler(&cryptowrap.Wrapper{
+		Keys:      keys,
+		Payload:   &TestData{},
+		Cipher:    cryptowrap.CipherAESGCM,
+		NotBefore: now.Add(time.Minute),
+		TTL:       time.Hour,
+		Clock:     clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Clock: clock})
+	if !errors.Is(err, cryptowrap.ErrNotYetValid) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	now = now.Add(30 * time.Minute)
+
+	dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Clock: clock}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dst.IssuedAt.Equal(now.Add(-30*time.Minute)) || !dst.ExpiresAt.Equal(now.Add(30*time.Minute)) {
+		t.Errorf("unexpected timestamps: %v %v", dst.IssuedAt, dst.ExpiresAt)
+	}
+
+	now = now.Add(time.Hour)
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Clock: clock})
+	if !errors.Is(err, cryptowrap.ErrExpired) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperExpiryNotAuthenticated(t *testing.T) {
+	_, err := json.Marshal(&cryptowrap.Wrapper{Keys: [][]byte{randBytes(16)}, Payload: &TestData{}, TTL: time.Hour})
+	if !errors.Is(err, cryptowrap.ErrNotAuthenticated) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperExpiryTampered(t *testing.T) {
+	keys := [][]byte{randBytes(16)}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{
+		Keys:    keys,
+		Payload: &TestData{},
+		Cipher:  cryptowrap.CipherAESCBCHMAC,
+		TTL:     time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope map[string]interface{}
+
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope["Header"].(map[string]interface{})["ExpiresAt"] = time.Now().Add(time.Hour).Unix()
+
+	data, err = json.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
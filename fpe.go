@@ -0,0 +1,479 @@
+package cryptowrap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// FPEMode is a format-preserving encryption algorithm used by FPE.
+type FPEMode uint8
+
+// Format-preserving encryption algorithms (NIST SP 800-38G Rev. 1).
+const (
+	// FPEFF1 is FF1 with the tweak of any length.
+	FPEFF1 FPEMode = iota
+	// FPEFF31 is FF3-1 with 56-bit tweak.
+	// 64-bit tweak of the original FF3 is accepted for compatibility with the data encrypted before FF3-1.
+	FPEFF31
+)
+
+// DigitsAlphabet is the default FPE alphabet.
+const DigitsAlphabet = "0123456789"
+
+// fpeMinDomain is the minimal number of the values in the domain (radix^length) allowed by SP 800-38G Rev. 1.
+const fpeMinDomain = 1000000
+
+// nolint: gomnd
+const (
+	ff1Rounds       = 10
+	ff3Rounds       = 8
+	ff3TweakSize    = 7
+	ff3LegacyTweak  = 8
+	maxFPERadix     = 1 << 16
+	ff3MaxLenFactor = 96
+)
+
+// Errors might be returned by FPE.
+var (
+	ErrInvalidAlphabet = errors.New("invalid FPE alphabet")
+	ErrInvalidValue    = errors.New("value could not be encrypted with FPE")
+	ErrInvalidTweak    = errors.New("invalid FPE tweak")
+	ErrUnknownFPEMode  = errors.New("unknown FPE mode")
+)
+
+// FPE is a struct with custom JSON/Gob/Binary marshaler and unmarshaler
+// encrypting the Value with format-preserving encryption: the encrypted value is a string
+// of the same length over the same Alphabet, so it fits the legacy columns (card numbers, phone numbers etc).
+//
+// Mode selects the algorithm, FF1 by default. Alphabet is a set of distinct characters, digits by default.
+// Every character of the Value must belong to the Alphabet and the Value must be long enough:
+// the number of the possible values must be one million at least.
+//
+// Tweak is an optional public value changing the encryption, e.g. the column name.
+// FF3-1 requires 7 bytes tweak, zero one used if no tweak provided.
+//
+// Value is encrypted with the first value from Keys or the primary key of KeyRing (16, 24 or 32 bytes long).
+// FPE is not authenticated, so the wrong key could not be detected
+// and Unmarshaler decrypts the Value with the same key only. Re-encrypt the data after key rotation.
+//
+// Equal values produce equal encrypted values for the same key and tweak.
+type FPE struct {
+	Keys     [][]byte
+	KeyRing  *KeyRing
+	Mode     FPEMode
+	Alphabet string
+	Tweak    []byte
+	Value    string
+}
+
+// MarshalJSON is a custom marshaler.
+func (f *FPE) MarshalJSON() ([]byte, error) {
+	encrypted, err := f.Encrypt(f.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(encrypted)
+}
+
+// UnmarshalJSON is a custom unmarshaler.
+func (f *FPE) UnmarshalJSON(data []byte) error {
+	var encrypted string
+
+	if err := json.Unmarshal(data, &encrypted); err != nil {
+		return fmt.Errorf("unmarshaling: %w", err)
+	}
+
+	return f.decryptValue(encrypted)
+}
+
+// GobEncode is a custom marshaler.
+func (f *FPE) GobEncode() ([]byte, error) {
+	return f.MarshalBinary()
+}
+
+// GobDecode is a custom unmarshaler.
+func (f *FPE) GobDecode(data []byte) error {
+	return f.UnmarshalBinary(data)
+}
+
+// MarshalBinary is a custom marshaler to be used with MsgPack (github.com/ugorji/go/codec).
+func (f *FPE) MarshalBinary() ([]byte, error) {
+	encrypted, err := f.Encrypt(f.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(encrypted), nil
+}
+
+// UnmarshalBinary is a custom unmarshaler to be used with MsgPack (github.com/ugorji/go/codec).
+func (f *FPE) UnmarshalBinary(data []byte) error {
+	return f.decryptValue(string(data))
+}
+
+// Encrypt returns the value encrypted, e.g. to be used in the queries.
+func (f *FPE) Encrypt(value string) (string, error) {
+	return f.crypt(value, true)
+}
+
+// Decrypt returns the value decrypted.
+func (f *FPE) Decrypt(value string) (string, error) {
+	return f.crypt(value, false)
+}
+
+func (f *FPE) decryptValue(encrypted string) error {
+	value, err := f.Decrypt(encrypted)
+	if err != nil {
+		return err
+	}
+
+	f.Value = value
+
+	return nil
+}
+
+func (f *FPE) crypt(value string, encrypt bool) (string, error) {
+	keys, err := symmetricKeys(f.Keys, nil, f.KeyRing)
+	if err != nil {
+		return "", err
+	}
+
+	if !keys.primary {
+		return "", ErrNoPrimaryKey
+	}
+
+	alphabet, index, err := f.alphabet()
+	if err != nil {
+		return "", err
+	}
+
+	radix := len(alphabet)
+
+	numerals, err := toNumerals(value, index)
+	if err != nil {
+		return "", err
+	}
+
+	if err = checkFPELength(f.Mode, radix, len(numerals)); err != nil {
+		return "", err
+	}
+
+	result, err := f.transform(keys.keys[0], radix, numerals, encrypt)
+	if err != nil {
+		return "", err
+	}
+
+	out := make([]rune, len(result))
+	for i, n := range result {
+		out[i] = alphabet[n]
+	}
+
+	return string(out), nil
+}
+
+// toNumerals returns the alphabet indexes of the value characters.
+func toNumerals(value string, index map[rune]int) ([]int, error) {
+	numerals := make([]int, 0, len(value))
+
+	for _, r := range value {
+		i, ok := index[r]
+		if !ok {
+			return nil, fmt.Errorf("%w: character %q is not in the alphabet", ErrInvalidValue, r)
+		}
+
+		numerals = append(numerals, i)
+	}
+
+	return numerals, nil
+}
+
+// transform encrypts or decrypts the numerals with the key in the Mode selected.
+func (f *FPE) transform(key []byte, radix int, numerals []int, encrypt bool) ([]int, error) {
+	if f.Mode == FPEFF31 {
+		tweak, err := ff3Tweak(f.Tweak)
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := aes.NewCipher(reverseBytes(key))
+		if err != nil {
+			return nil, err
+		}
+
+		return ff3(block, radix, tweak, numerals, encrypt), nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ff1(block, radix, f.Tweak, numerals, encrypt), nil
+}
+
+// alphabet returns the alphabet characters and their indexes.
+func (f *FPE) alphabet() ([]rune, map[rune]int, error) {
+	alphabet := f.Alphabet
+	if alphabet == "" {
+		alphabet = DigitsAlphabet
+	}
+
+	runes := []rune(alphabet)
+	index := make(map[rune]int, len(runes))
+
+	for i, r := range runes {
+		if _, ok := index[r]; ok {
+			return nil, nil, fmt.Errorf("%w: duplicate character %q", ErrInvalidAlphabet, r)
+		}
+
+		index[r] = i
+	}
+
+	if len(runes) < 2 || len(runes) > maxFPERadix {
+		return nil, nil, fmt.Errorf("%w: %d characters", ErrInvalidAlphabet, len(runes))
+	}
+
+	return runes, index, nil
+}
+
+// checkFPELength checks the value length is in the range allowed by the mode.
+func checkFPELength(mode FPEMode, radix, n int) error {
+	r := big.NewInt(int64(radix))
+
+	if new(big.Int).Exp(r, big.NewInt(int64(n)), nil).Cmp(big.NewInt(fpeMinDomain)) < 0 {
+		return fmt.Errorf("%w: value is too short", ErrInvalidValue)
+	}
+
+	switch mode {
+	case FPEFF1:
+		if uint64(n) > 1<<32 { // nolint: gomnd
+			return fmt.Errorf("%w: value is too long", ErrInvalidValue)
+		}
+	case FPEFF31:
+		// maxlen = 2 * floor(log_radix(2^96))
+		limit := new(big.Int).Lsh(big.NewInt(1), ff3MaxLenFactor)
+		half := 0
+
+		for p := new(big.Int).Set(r); p.Cmp(limit) <= 0; p.Mul(p, r) {
+			half++
+		}
+
+		if n > 2*half {
+			return fmt.Errorf("%w: value is too long", ErrInvalidValue)
+		}
+	default:
+		return fmt.Errorf("%w: %d", ErrUnknownFPEMode, mode)
+	}
+
+	return nil
+}
+
+// ff1 is FF1 encryption (or decryption) of the numerals.
+func ff1(block cipher.Block, radix int, tweak []byte, x []int, encrypt bool) []int {
+	n := len(x)
+	u := n / 2 // nolint: gomnd
+	v := n - u
+
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+
+	bigRadix := big.NewInt(int64(radix))
+	modU := new(big.Int).Exp(bigRadix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(bigRadix, big.NewInt(int64(v)), nil)
+
+	// b = ceil(ceil(v * log2(radix)) / 8)
+	bLen := (new(big.Int).Sub(modV, big.NewInt(1)).BitLen() + 7) / 8 // nolint: gomnd
+	d := 4*((bLen+3)/4) + 4                                          // nolint: gomnd
+
+	p := make([]byte, 0, aes.BlockSize)
+	p = append(p, 1, 2, 1, byte(radix>>16), byte(radix>>8), byte(radix), ff1Rounds, byte(u)) // nolint: gomnd
+	p = binary.BigEndian.AppendUint32(p, uint32(n))
+	p = binary.BigEndian.AppendUint32(p, uint32(len(tweak)))
+
+	padLen := (aes.BlockSize - (len(tweak)+bLen+1)%aes.BlockSize) % aes.BlockSize
+
+	q := make([]byte, len(tweak)+padLen+1+bLen)
+	copy(q, tweak)
+
+	for r := 0; r < ff1Rounds; r++ {
+		i := r
+		if !encrypt {
+			i = ff1Rounds - 1 - r
+		}
+
+		m, mod := u, modU
+		if i%2 == 1 {
+			m, mod = v, modV
+		}
+
+		src := b
+		if !encrypt {
+			src = a
+		}
+
+		q[len(tweak)+padLen] = byte(i)
+		numRadix(src, bigRadix).FillBytes(q[len(q)-bLen:])
+
+		y := new(big.Int).SetBytes(ff1Expand(block, p, q, d))
+
+		if encrypt {
+			c := y.Add(y, numRadix(a, bigRadix)).Mod(y, mod)
+			a, b = b, strRadix(c, bigRadix, m)
+		} else {
+			c := y.Sub(numRadix(b, bigRadix), y).Mod(y, mod)
+			a, b = strRadix(c, bigRadix, m), a
+		}
+	}
+
+	return append(a, b...)
+}
+
+// ff1Expand calculates R = PRF(P || Q) (CBC-MAC with zero IV) and expands it to d bytes:
+// R || CIPH(R xor [1]) || CIPH(R xor [2]) || ...
+func ff1Expand(block cipher.Block, p, q []byte, d int) []byte {
+	r := make([]byte, aes.BlockSize)
+
+	for _, data := range [][]byte{p, q} {
+		for len(data) > 0 {
+			for k := range r {
+				r[k] ^= data[k]
+			}
+
+			block.Encrypt(r, r)
+			data = data[aes.BlockSize:]
+		}
+	}
+
+	s := append(make([]byte, 0, d+aes.BlockSize), r...)
+
+	for j := uint64(1); len(s) < d; j++ {
+		x := make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(x[8:], j)
+
+		for k := range x {
+			x[k] ^= r[k]
+		}
+
+		block.Encrypt(x, x)
+		s = append(s, x...)
+	}
+
+	return s[:d]
+}
+
+// ff3Tweak returns 64-bit tweak: FF3-1 56-bit tweak is converted, FF3 64-bit one is used as is.
+func ff3Tweak(tweak []byte) ([]byte, error) {
+	switch len(tweak) {
+	case 0:
+		return make([]byte, ff3LegacyTweak), nil
+	case ff3TweakSize:
+		return []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0, tweak[4], tweak[5], tweak[6], tweak[3] << 4}, nil // nolint: gomnd
+	case ff3LegacyTweak:
+		return tweak, nil
+	default:
+		return nil, fmt.Errorf("%w: %d bytes", ErrInvalidTweak, len(tweak))
+	}
+}
+
+// ff3 is FF3 encryption (or decryption) of the numerals with 64-bit tweak.
+// block must be initialized with the byte-reversed key.
+func ff3(block cipher.Block, radix int, tweak []byte, x []int, encrypt bool) []int {
+	n := len(x)
+	v := n / 2 // nolint: gomnd
+	u := n - v
+
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+
+	bigRadix := big.NewInt(int64(radix))
+	modU := new(big.Int).Exp(bigRadix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(bigRadix, big.NewInt(int64(v)), nil)
+
+	tl, tr := tweak[:4], tweak[4:]
+
+	p := make([]byte, aes.BlockSize)
+
+	for r := 0; r < ff3Rounds; r++ {
+		i := r
+		if !encrypt {
+			i = ff3Rounds - 1 - r
+		}
+
+		m, mod, w := u, modU, tr
+		if i%2 == 1 {
+			m, mod, w = v, modV, tl
+		}
+
+		src := b
+		if !encrypt {
+			src = a
+		}
+
+		copy(p, w)
+		p[3] ^= byte(i)
+		numRadix(reverseInts(src), bigRadix).FillBytes(p[4:])
+
+		s := reverseBytes(p)
+		block.Encrypt(s, s)
+		y := new(big.Int).SetBytes(reverseBytes(s))
+
+		if encrypt {
+			c := y.Add(y, numRadix(reverseInts(a), bigRadix)).Mod(y, mod)
+			a, b = b, reverseInts(strRadix(c, bigRadix, m))
+		} else {
+			c := y.Sub(numRadix(reverseInts(b), bigRadix), y).Mod(y, mod)
+			a, b = reverseInts(strRadix(c, bigRadix, m)), a
+		}
+	}
+
+	return append(a, b...)
+}
+
+// numRadix returns the number represented by the numerals, the most significant first.
+func numRadix(x []int, radix *big.Int) *big.Int {
+	n := new(big.Int)
+
+	for _, d := range x {
+		n.Mul(n, radix).Add(n, big.NewInt(int64(d)))
+	}
+
+	return n
+}
+
+// strRadix returns m numerals representing the number, the most significant first.
+func strRadix(n *big.Int, radix *big.Int, m int) []int {
+	x := make([]int, m)
+	n = new(big.Int).Set(n)
+	d := new(big.Int)
+
+	for i := m - 1; i >= 0; i-- {
+		n.DivMod(n, radix, d)
+		x[i] = int(d.Int64())
+	}
+
+	return x
+}
+
+func reverseInts(x []int) []int {
+	out := make([]int, len(x))
+	for i := range x {
+		out[len(x)-1-i] = x[i]
+	}
+
+	return out
+}
+
+func reverseBytes(x []byte) []byte {
+	out := make([]byte, len(x))
+	for i := range x {
+		out[len(x)-1-i] = x[i]
+	}
+
+	return out
+}
@@ -0,0 +1,257 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+const base36Alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// NIST SP 800-38G samples, FF1 and FF3 (64-bit tweak).
+func TestFPEVectors(t *testing.T) {
+	vectors := []struct {
+		mode                 cryptowrap.FPEMode
+		key, tweak, alphabet string
+		plaintext, expected  string
+	}{
+		{
+			mode:      cryptowrap.FPEFF1,
+			key:       "2B7E151628AED2A6ABF7158809CF4F3C",
+			plaintext: "0123456789",
+			expected:  "2433477484",
+		},
+		{
+			mode:      cryptowrap.FPEFF1,
+			key:       "2B7E151628AED2A6ABF7158809CF4F3C",
+			tweak:     "39383736353433323130",
+			plaintext: "0123456789",
+			expected:  "6124200773",
+		},
+		{
+			mode:      cryptowrap.FPEFF1,
+			key:       "2B7E151628AED2A6ABF7158809CF4F3C",
+			tweak:     "3737373770717273373737",
+			alphabet:  base36Alphabet,
+			plaintext: "0123456789abcdefghi",
+			expected:  "a9tv40mll9kdu509eum",
+		},
+		{
+			mode:      cryptowrap.FPEFF1,
+			key:       "2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F",
+			plaintext: "0123456789",
+			expected:  "2830668132",
+		},
+		{
+			mode:      cryptowrap.FPEFF1,
+			key:       "2B7E151628AED2A6ABF7158809CF4F3CEF4359D8D580AA4F7F036D6F04FC6A94",
+			plaintext: "0123456789",
+			expected:  "6657667009",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:     "D8E7920AFA330A73",
+			plaintext: "890121234567890000",
+			expected:  "750918814058654607",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:     "9A768A92F60E12D8",
+			plaintext: "890121234567890000",
+			expected:  "018989839189395384",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:     "D8E7920AFA330A73",
+			plaintext: "89012123456789000000789000000",
+			expected:  "48598367162252569629397416226",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:     "9A768A92F60E12D8",
+			alphabet:  base36Alphabet[:26],
+			plaintext: "0123456789abcdefghi",
+			expected:  "g2pk40i992fn20cjakb",
+		},
+		// ACVP AES-FF3-1 samples with 56-bit tweak.
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "2DE79D232DF5585D68CE47882AE256D6",
+			tweak:     "CBD09280979564",
+			plaintext: "3992520240",
+			expected:  "8901801106",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "01C63017111438F7FC8E24EB16C71AB5",
+			tweak:     "C4E822DCD09F27",
+			plaintext: "60761757463116869318437658042297305934914824457484538562",
+			expected:  "35637144092473838892796702739628394376915177448290847293",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "718385E6542534604419E83CE387A437",
+			tweak:     "B6F35084FA90E1",
+			alphabet:  "abcdefghijklmnopqrstuvwxyz",
+			plaintext: "wfmwlrorcd",
+			expected:  "ywowehycyd",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "DB602DFF22ED7E84C8D8C865A941A238",
+			tweak:     "EBEFD63BCC2083",
+			alphabet:  "abcdefghijklmnopqrstuvwxyz",
+			plaintext: "kkuomenbzqvggfbteqdyanwpmhzdmoicekiihkrm",
+			expected:  "belcfahcwwytwrckieymthabgjjfkxtxauipmjja",
+		},
+		{
+			mode:      cryptowrap.FPEFF31,
+			key:       "AEE87D0D485B3AFD12BD1E0B9D03D50D",
+			tweak:     "5F9140601D224B",
+			alphabet:  "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz+/",
+			plaintext: "ixvuuIHr0e",
+			expected:  "GR90R1q838",
+		},
+	}
+
+	for i, v := range vectors {
+		f := cryptowrap.FPE{
+			Keys:     [][]byte{unhex(t, v.key)},
+			Mode:     v.mode,
+			Alphabet: v.alphabet,
+			Tweak:    unhex(t, v.tweak),
+		}
+
+		encrypted, err := f.Encrypt(v.plaintext)
+		if err != nil {
+			t.Fatalf("vector %d: %v", i, err)
+		}
+
+		if encrypted != v.expected {
+			t.Errorf("vector %d: unexpected ciphertext: %s", i, encrypted)
+
+			continue
+		}
+
+		decrypted, err := f.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("vector %d: %v", i, err)
+		}
+
+		if decrypted != v.plaintext {
+			t.Errorf("vector %d: decrypted is not equal to original: %s", i, decrypted)
+		}
+	}
+}
+
+type cardRecord struct {
+	Card  *cryptowrap.FPE
+	Phone *cryptowrap.FPE
+}
+
+func TestFPEJSON(t *testing.T) {
+	testFPE(t, json.Marshal, json.Unmarshal)
+}
+
+func TestFPEGob(t *testing.T) {
+	testFPE(t, gobMarshal, gobUnmarshal)
+}
+
+func TestFPEMsgp(t *testing.T) {
+	testFPE(t, binMarshal, binUnmarshal)
+}
+
+func testFPE(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	ring, err := cryptowrap.NewKeyRing(
+		cryptowrap.KeyEntry{ID: "k1", State: cryptowrap.KeyPrimary, Secret: randBytes(32)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phoneAlphabet := "0123456789+-() "
+	tweak := randBytes(7)
+
+	orig := cardRecord{
+		Card:  &cryptowrap.FPE{KeyRing: ring, Value: "4111111111111111"},
+		Phone: &cryptowrap.FPE{KeyRing: ring, Mode: cryptowrap.FPEFF31, Alphabet: phoneAlphabet, Tweak: tweak, Value: "+1 (555) 123-4567"},
+	}
+
+	data, err := marshaler(&orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card, err := orig.Card.Encrypt(orig.Card.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(card) != len(orig.Card.Value) || card == orig.Card.Value {
+		t.Errorf("unexpected encrypted card: %s", card)
+	}
+
+	encrypted := cardRecord{
+		Card:  &cryptowrap.FPE{KeyRing: ring},
+		Phone: &cryptowrap.FPE{KeyRing: ring, Mode: cryptowrap.FPEFF31, Alphabet: phoneAlphabet, Tweak: tweak},
+	}
+
+	err = unmarshaler(data, &encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(orig.Card.Value, encrypted.Card.Value) || !reflect.DeepEqual(orig.Phone.Value, encrypted.Phone.Value) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cardRecord{Card: &cryptowrap.FPE{KeyRing: ring}, Phone: &cryptowrap.FPE{KeyRing: ring}})
+	if !errors.Is(err, cryptowrap.ErrInvalidValue) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFPENegative(t *testing.T) {
+	keys := [][]byte{randBytes(16)}
+
+	_, err := (&cryptowrap.FPE{Keys: keys}).Encrypt("12345")
+	if !errors.Is(err, cryptowrap.ErrInvalidValue) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = (&cryptowrap.FPE{Keys: keys}).Encrypt("12345abcd")
+	if !errors.Is(err, cryptowrap.ErrInvalidValue) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = (&cryptowrap.FPE{Keys: keys, Alphabet: "0123456789012"}).Encrypt("1234567890")
+	if !errors.Is(err, cryptowrap.ErrInvalidAlphabet) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = (&cryptowrap.FPE{Keys: keys, Mode: cryptowrap.FPEFF31}).Encrypt("123456789012345678901234567890123456789012345678901234567")
+	if !errors.Is(err, cryptowrap.ErrInvalidValue) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = (&cryptowrap.FPE{Keys: keys, Mode: cryptowrap.FPEFF31, Tweak: randBytes(5)}).Encrypt("1234567890")
+	if !errors.Is(err, cryptowrap.ErrInvalidTweak) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = (&cryptowrap.FPE{Keys: keys, Mode: cryptowrap.FPEMode(9)}).Encrypt("1234567890")
+	if !errors.Is(err, cryptowrap.ErrUnknownFPEMode) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package cryptowrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FS is the fs.FS decrypting the files of the underlying fs.FS encrypted by EncryptDir.
+// File names and the directory tree are not encrypted, but every file is bound to its path
+// relative to the root of the tree encrypted, so the files could not be swapped or renamed.
+//
+// Files opened implement io.ReaderAt and io.Seeker, only the chunks requested are decrypted
+// if the underlying file implements io.ReaderAt (os.DirFS and embed.FS files do), otherwise the file is read in memory.
+// Opening the file unwraps the key (KeyProvider is called) and authenticates the file trailer.
+//
+// Stat and ReadDir report the decrypted file sizes calculated from the encrypted file header and size
+// with no key unwrapped, so these sizes are not authenticated until the file is opened.
+type FS struct {
+	fsys    fs.FS
+	wrapper Wrapper
+}
+
+// NewFS returns the FS decrypting the files of fsys.
+// Keys, KeyIDs, KeyRing, KeyProvider, Context and AssociatedData of the Wrapper provided are used.
+// Wrapper is copied, so it is safe to open the files concurrently.
+func NewFS(fsys fs.FS, w *Wrapper) *FS {
+	return &FS{fsys: fsys, wrapper: *w}
+}
+
+// Open opens the named file decrypting it if it is not a directory.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := fsys.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close() // nolint: errcheck
+
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &dir{File: f, fsys: fsys, name: name}, nil
+	}
+
+	r, err := fsys.decrypt(f, name, info.Size())
+	if err != nil {
+		f.Close() // nolint: errcheck
+
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &file{f: f, SeekableReader: r, info: fileInfo{FileInfo: info, size: r.Size()}}, nil
+}
+
+// Stat returns the fs.FileInfo of the named file with the decrypted file size.
+// The file is not decrypted, the size is calculated from the header and the size of the encrypted file.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := fsys.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() // nolint: errcheck
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+
+	size, err := seekableSize(f, info.Size())
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return fileInfo{FileInfo: info, size: size}, nil
+}
+
+// decrypt returns the reader decrypting the underlying file of size provided.
+func (fsys *FS) decrypt(f fs.File, name string, size int64) (*SeekableReader, error) {
+	src, ok := f.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading file: %w", err)
+		}
+
+		src, size = bytes.NewReader(data), int64(len(data))
+	}
+
+	w := fsys.wrapper
+	w.AssociatedData = fileAssociatedData(w.AssociatedData, name)
+
+	return NewSeekableReader(src, size, &w)
+}
+
+// file is the decrypted file.
+type file struct {
+	*SeekableReader
+	f    fs.File
+	info fileInfo
+}
+
+// Stat returns the fs.FileInfo with the decrypted file size.
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// Close closes the underlying file.
+func (f *file) Close() error {
+	return f.f.Close()
+}
+
+// fileInfo is the fs.FileInfo of the encrypted file reporting the decrypted file size.
+type fileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+// Size returns the decrypted file size.
+func (fi fileInfo) Size() int64 {
+	return fi.size
+}
+
+// dir is the directory of FS. Entries info report the decrypted file sizes.
+type dir struct {
+	fs.File
+	fsys *FS
+	name string
+}
+
+// ReadDir reads the directory entries.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rd, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrInvalid}
+	}
+
+	entries, err := rd.ReadDir(n)
+
+	for i, entry := range entries {
+		entries[i] = dirEntry{DirEntry: entry, fsys: d.fsys, name: path.Join(d.name, entry.Name())}
+	}
+
+	return entries, err
+}
+
+// dirEntry is the directory entry of FS.
+type dirEntry struct {
+	fs.DirEntry
+	fsys *FS
+	name string
+}
+
+// Info returns the fs.FileInfo of the entry with the decrypted file size, see FS.Stat.
+func (e dirEntry) Info() (fs.FileInfo, error) {
+	if e.IsDir() {
+		return e.DirEntry.Info()
+	}
+
+	return e.fsys.Stat(e.name)
+}
+
+// EncryptDir encrypts the regular files of src to the seekable blobs in the directory dst
+// preserving the directory tree, file names and permissions. Result could be read with NewFS(os.DirFS(dst), w).
+//
+// Wrapper provided is used the same way as by NewSeekableWriter.
+// The file path relative to src root is authenticated with AssociatedData.
+func EncryptDir(dst string, src fs.FS, w *Wrapper) error {
+	return fs.WalkDir(src, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(name))
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700) // nolint: gomnd
+		case entry.Type().IsRegular():
+			return encryptFile(target, src, name, info.Mode().Perm(), w)
+		default:
+			return nil
+		}
+	})
+}
+
+// encryptFile encrypts the named file of src to the seekable blob in target.
+func encryptFile(target string, src fs.FS, name string, perm fs.FileMode, w *Wrapper) (err error) {
+	in, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close() // nolint: errcheck
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	fw := *w
+	fw.AssociatedData = fileAssociatedData(w.AssociatedData, name)
+
+	enc, err := NewSeekableWriter(out, &fw)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(enc, in); err != nil {
+		return fmt.Errorf("encrypting %s: %w", name, err)
+	}
+
+	return enc.Close()
+}
+
+// fileAssociatedData returns the associated data binding the file to its path:
+// length-prefixed associated data provided followed by the cleaned slash-separated path.
+func fileAssociatedData(associatedData []byte, name string) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(associatedData)))
+	buf = append(buf, associatedData...)
+
+	return append(buf, path.Clean(name)...)
+}
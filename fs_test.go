@@ -0,0 +1,207 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestFS(t *testing.T) {
+	keys := [][]byte{randBytes(32), randBytes(32)}
+
+	plain := fstest.MapFS{
+		"config.json":         {Data: []byte(`{"key":"value"}`), Mode: 0o600},
+		"empty.txt":           {Data: []byte{}, Mode: 0o644},
+		"templates/large.txt": {Data: randBytes(200000), Mode: 0o644},
+		"templates/a/b.tmpl":  {Data: []byte("{{.Field}}"), Mode: 0o644},
+	}
+
+	dst := t.TempDir()
+
+	err := cryptowrap.EncryptDir(dst, plain, &cryptowrap.Wrapper{Keys: keys[1:], Cipher: cryptowrap.CipherXChaCha20Poly1305})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := os.ReadFile(filepath.Join(dst, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(encrypted) == string(plain["config.json"].Data) {
+		t.Error("file is not encrypted")
+	}
+
+	for name, fsys := range map[string]fs.FS{
+		"dir": cryptowrap.NewFS(os.DirFS(dst), &cryptowrap.Wrapper{Keys: keys}),
+		"map": cryptowrap.NewFS(readAll(t, os.DirFS(dst)), &cryptowrap.Wrapper{Keys: keys}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := fstest.TestFS(fsys, "config.json", "empty.txt", "templates/large.txt", "templates/a/b.tmpl"); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, file := range plain {
+				data, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(data) != string(file.Data) {
+					t.Errorf("%s: decrypted is not equal to original", name)
+				}
+			}
+		})
+	}
+}
+
+func TestFSNegative(t *testing.T) {
+	dst := t.TempDir()
+
+	err := cryptowrap.EncryptDir(
+		dst,
+		fstest.MapFS{"a.txt": {Data: []byte("data")}},
+		&cryptowrap.Wrapper{Keys: [][]byte{randBytes(16)}, Cipher: cryptowrap.CipherAESGCM},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := cryptowrap.NewFS(os.DirFS(dst), &cryptowrap.Wrapper{Keys: [][]byte{randBytes(16)}})
+
+	_, err = fs.ReadFile(fsys, "a.txt")
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = fs.ReadFile(fsys, "missing.txt")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// readAll returns the copy of fsys in memory, files of it do not implement io.ReaderAt.
+func readAll(t *testing.T, fsys fs.FS) fs.FS {
+	t.Helper()
+
+	files := fstest.MapFS{}
+
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		files[name] = &fstest.MapFile{Data: data}
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readerFS{files}
+}
+
+// readerFS hides io.ReaderAt and io.Seeker of the files opened.
+type readerFS struct {
+	fs.FS
+}
+
+func (fsys readerFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return f, nil
+	}
+
+	return readerFile{f}, nil
+}
+
+type readerFile struct {
+	fs.File
+}
+
+func TestFSSwapped(t *testing.T) {
+	keys := [][]byte{randBytes(32)}
+	dst := t.TempDir()
+
+	err := cryptowrap.EncryptDir(
+		dst,
+		fstest.MapFS{
+			"config.json":     {Data: []byte(`{"admin":false}`)},
+			"dir/config.json": {Data: []byte(`{"admin":true}`)},
+		},
+		&cryptowrap.Wrapper{Keys: keys, Cipher: cryptowrap.CipherAESGCM},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Rename(filepath.Join(dst, "dir", "config.json"), filepath.Join(dst, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fs.ReadFile(cryptowrap.NewFS(os.DirFS(dst), &cryptowrap.Wrapper{Keys: keys}), "config.json")
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFSStatNoUnwrap(t *testing.T) {
+	provider, err := cryptowrap.NewMemoryKeyProvider(randBytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	plain := randBytes(3*streamChunkSize + 10)
+
+	err = cryptowrap.EncryptDir(
+		dst,
+		fstest.MapFS{"a.bin": {Data: plain}},
+		&cryptowrap.Wrapper{KeyProvider: provider, Cipher: cryptowrap.CipherAESGCM},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &countingKeyProvider{KeyProvider: provider}
+	fsys := cryptowrap.NewFS(os.DirFS(dst), &cryptowrap.Wrapper{KeyProvider: counting})
+
+	info, err := fs.Stat(fsys, "a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != int64(len(plain)) || counting.unwrapped != 0 {
+		t.Errorf("unexpected size %d or keys unwrapped %d", info.Size(), counting.unwrapped)
+	}
+
+	data, err := fs.ReadFile(fsys, "a.bin")
+	if err != nil || !bytes.Equal(data, plain) || counting.unwrapped != 1 {
+		t.Errorf("decrypted is not equal to original or keys unwrapped %d: %v", counting.unwrapped, err)
+	}
+}
+
+type countingKeyProvider struct {
+	cryptowrap.KeyProvider
+	unwrapped int
+}
+
+func (p *countingKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	p.unwrapped++
+
+	return p.KeyProvider.UnwrapKey(ctx, wrapped)
+}
@@ -0,0 +1,229 @@
+package cryptowrap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+// gcmSIVNonceSize is the nonce length of AES-GCM-SIV.
+const gcmSIVNonceSize = 12
+
+// gcmSIVAEAD is AES-GCM-SIV (RFC 8452) nonce misuse-resistant authenticated encryption.
+// Message encryption and authentication keys are derived from the key and nonce for every message.
+type gcmSIVAEAD struct {
+	block cipher.Block
+	key   []byte
+}
+
+// NewGCMSIV returns AES-GCM-SIV (RFC 8452) AEAD. Key must be 16 or 32 bytes long, nonce is 12 bytes long.
+//
+// Unlike GCM, nonce reuse reveals equality of the messages encrypted with the same nonce and additional data only.
+func NewGCMSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 { // nolint: gomnd
+		return nil, ErrInvalidKeySize
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcmSIVAEAD{block: block, key: key}, nil
+}
+
+// NonceSize returns the nonce length.
+func (g *gcmSIVAEAD) NonceSize() int {
+	return gcmSIVNonceSize
+}
+
+// Overhead returns the tag length.
+func (g *gcmSIVAEAD) Overhead() int {
+	return aes.BlockSize
+}
+
+// Seal encrypts and authenticates the plaintext, the tag is appended to the ciphertext.
+func (g *gcmSIVAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("cryptowrap: incorrect nonce length given to AES-GCM-SIV")
+	}
+
+	authKey, encBlock := g.deriveKeys(nonce)
+	tag := gcmSIVTag(encBlock, authKey, nonce, plaintext, additionalData)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+aes.BlockSize)
+	gcmSIVCTR(encBlock, tag, out, plaintext)
+	copy(out[len(plaintext):], tag)
+
+	return ret
+}
+
+// Open verifies and decrypts the ciphertext produced by Seal.
+func (g *gcmSIVAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != gcmSIVNonceSize || len(ciphertext) < aes.BlockSize {
+		return nil, ErrUndecryptable
+	}
+
+	tag := ciphertext[len(ciphertext)-aes.BlockSize:]
+	ciphertext = ciphertext[:len(ciphertext)-aes.BlockSize]
+
+	authKey, encBlock := g.deriveKeys(nonce)
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	gcmSIVCTR(encBlock, tag, out, ciphertext)
+
+	if subtle.ConstantTimeCompare(tag, gcmSIVTag(encBlock, authKey, nonce, out, additionalData)) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+
+		return nil, ErrUndecryptable
+	}
+
+	return ret, nil
+}
+
+// deriveKeys returns the message authentication key and the message encryption cipher.
+func (g *gcmSIVAEAD) deriveKeys(nonce []byte) ([]byte, cipher.Block) {
+	var in, out [aes.BlockSize]byte
+
+	copy(in[4:], nonce)
+
+	derived := make([]byte, 0, aes.BlockSize+len(g.key))
+
+	for i := uint32(0); len(derived) < cap(derived); i++ {
+		binary.LittleEndian.PutUint32(in[:4], i)
+		g.block.Encrypt(out[:], in[:])
+		derived = append(derived, out[:8]...)
+	}
+
+	encBlock, err := aes.NewCipher(derived[aes.BlockSize:])
+	if err != nil {
+		panic(err) // key length is checked by NewGCMSIV
+	}
+
+	return derived[:aes.BlockSize], encBlock
+}
+
+// gcmSIVTag calculates the tag: POLYVAL of additional data, plaintext and their lengths
+// xored with the nonce and encrypted with the message encryption key.
+func gcmSIVTag(encBlock cipher.Block, authKey, nonce, plaintext, additionalData []byte) []byte {
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+
+	var lengths [aes.BlockSize]byte
+
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8) // nolint: gomnd
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)      // nolint: gomnd
+	p.update(lengths[:])
+
+	s := p.sum()
+
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+
+	s[15] &= 0x7f
+
+	tag := make([]byte, aes.BlockSize)
+	encBlock.Encrypt(tag, s)
+
+	return tag
+}
+
+// gcmSIVCTR encrypts/decrypts src to dst with AES-CTR: initial counter is the tag with the top bit set,
+// 32-bit little-endian counter in the first four bytes is incremented.
+func gcmSIVCTR(encBlock cipher.Block, tag, dst, src []byte) {
+	var counter, stream [aes.BlockSize]byte
+
+	copy(counter[:], tag)
+	counter[15] |= 0x80
+
+	for len(src) > 0 {
+		encBlock.Encrypt(stream[:], counter[:])
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+
+		n := subtle.XORBytes(dst, src, stream[:])
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// fieldElement is an element of GF(2^128) in POLYVAL (little-endian) representation:
+// bit i of lo is the coefficient of x^i, bit i of hi is the coefficient of x^(64+i).
+type fieldElement struct {
+	lo, hi uint64
+}
+
+// polyval calculates POLYVAL (RFC 8452) of the data padded to the block size.
+type polyval struct {
+	h fieldElement
+	s fieldElement
+}
+
+// xInv128 is x^-128 modulo x^128 + x^127 + x^126 + x^121 + 1.
+var xInv128 = fieldElement{lo: 1, hi: 1<<63 | 1<<60 | 1<<57 | 1<<50} // nolint: gochecknoglobals
+
+// newPolyval returns POLYVAL with the key provided.
+// dot(a, H) = a * H * x^-128, so H * x^-128 is precomputed.
+func newPolyval(key []byte) *polyval {
+	return &polyval{h: fieldMul(loadElement(key), xInv128)}
+}
+
+// update processes the data padded with zeros to the block size.
+func (p *polyval) update(data []byte) {
+	var block [aes.BlockSize]byte
+
+	for len(data) > 0 {
+		n := copy(block[:], data)
+		for i := n; i < len(block); i++ {
+			block[i] = 0
+		}
+
+		data = data[n:]
+
+		x := loadElement(block[:])
+		p.s = fieldMul(fieldElement{lo: p.s.lo ^ x.lo, hi: p.s.hi ^ x.hi}, p.h)
+	}
+}
+
+func (p *polyval) sum() []byte {
+	out := make([]byte, aes.BlockSize)
+	binary.LittleEndian.PutUint64(out[:8], p.s.lo)
+	binary.LittleEndian.PutUint64(out[8:], p.s.hi)
+
+	return out
+}
+
+func loadElement(b []byte) fieldElement {
+	return fieldElement{lo: binary.LittleEndian.Uint64(b[:8]), hi: binary.LittleEndian.Uint64(b[8:16])}
+}
+
+// fieldMul multiplies the elements modulo x^128 + x^127 + x^126 + x^121 + 1 in constant time.
+func fieldMul(a, b fieldElement) fieldElement {
+	var r fieldElement
+
+	for i := 127; i >= 0; i-- {
+		// r = r * x mod P
+		carry := r.hi >> 63 // nolint: gomnd
+		r.hi = r.hi<<1 | r.lo>>63
+		r.lo <<= 1
+		mask := -carry
+		r.hi ^= mask & (1<<63 | 1<<62 | 1<<57)
+		r.lo ^= mask & 1
+
+		var bit uint64
+		if i >= 64 { // nolint: gomnd
+			bit = b.hi >> (i - 64) & 1
+		} else {
+			bit = b.lo >> i & 1
+		}
+
+		mask = -bit
+		r.lo ^= mask & a.lo
+		r.hi ^= mask & a.hi
+	}
+
+	return r
+}
@@ -0,0 +1,129 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+// RFC 8452 Appendix C.1 and C.2.
+func TestGCMSIVVectors(t *testing.T) {
+	vectors := []struct {
+		key, nonce, ad, plaintext, expected string
+	}{
+		{
+			key:      "01000000000000000000000000000000",
+			nonce:    "030000000000000000000000",
+			expected: "dc20e2d83f25705bb49e439eca56de25",
+		},
+		{
+			key:       "01000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			plaintext: "0100000000000000",
+			expected:  "b5d839330ac7b786578782fff6013b815b287c22493a364c",
+		},
+		{
+			key:       "01000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			ad:        "01",
+			plaintext: "0200000000000000",
+			expected:  "1e6daba35669f4273b0a1a2560969cdf790d99759abd1508",
+		},
+		{
+			key:      "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:    "030000000000000000000000",
+			expected: "07f5f4169bbf55a8400cd47ea6fd400f",
+		},
+		{
+			key:       "0100000000000000000000000000000000000000000000000000000000000000",
+			nonce:     "030000000000000000000000",
+			plaintext: "0100000000000000",
+			expected:  "c2ef328e5c71c83b843122130f7364b761e0b97427e3df28",
+		},
+	}
+
+	for i, v := range vectors {
+		aead, err := cryptowrap.NewGCMSIV(unhex(t, v.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nonce, ad, plaintext := unhex(t, v.nonce), unhex(t, v.ad), unhex(t, v.plaintext)
+
+		ciphertext := aead.Seal(nil, nonce, plaintext, ad)
+		if !bytes.Equal(ciphertext, unhex(t, v.expected)) {
+			t.Errorf("vector %d: unexpected ciphertext: %x", i, ciphertext)
+
+			continue
+		}
+
+		decrypted, err := aead.Open(nil, nonce, ciphertext, ad)
+		if err != nil {
+			t.Errorf("vector %d: %v", i, err)
+
+			continue
+		}
+
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("vector %d: decrypted is not equal to original", i)
+		}
+
+		ciphertext[0] ^= 1
+
+		if _, err = aead.Open(nil, nonce, ciphertext, ad); err == nil {
+			t.Errorf("vector %d: decrypted tampered data", i)
+		}
+	}
+}
+
+func TestWrapperGCMSIVJSON128(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESGCMSIV, 16, false, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperGCMSIVMsgp256Compress(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESGCMSIV, 32, true, binMarshal, binUnmarshal)
+}
+
+func TestWrapperGCMSIVNonceReuse(t *testing.T) {
+	key := randBytes(32)
+	iv := randBytes(12)
+
+	encrypt := func(payload *TestData) []byte {
+		data, err := json.Marshal(&cryptowrap.Wrapper{
+			Keys:    [][]byte{key},
+			IV:      iv,
+			Payload: payload,
+			Cipher:  cryptowrap.CipherAESGCMSIV,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data
+	}
+
+	data := encrypt(&TestData{Field1: "Field1"})
+	if bytes.Equal(data, encrypt(&TestData{Field1: "Field1"})) {
+		t.Error("junk is not random")
+	}
+
+	dst := cryptowrap.Wrapper{Keys: [][]byte{key}, Payload: &TestData{}}
+
+	err := json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&TestData{Field1: "Field1"}, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	_, err = cryptowrap.NewGCMSIV(randBytes(24))
+	if !errors.Is(err, cryptowrap.ErrInvalidKeySize) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
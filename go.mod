@@ -7,9 +7,11 @@ require (
 	github.com/fxamacker/cbor/v2 v2.9.2
 	github.com/pierrec/lz4 v2.6.1+incompatible
 	github.com/ugorji/go/codec v1.3.1
+	golang.org/x/crypto v0.33.0
 )
 
 require (
 	github.com/frankban/quicktest v1.10.0 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
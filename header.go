@@ -0,0 +1,137 @@
+package cryptowrap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Envelope format versions.
+const (
+	// versionLegacy is a header-less format produced by the early versions of the package.
+	versionLegacy uint8 = iota
+	// versionCurrent is a format with self-describing header.
+	versionCurrent
+)
+
+// cipherRSAOAEP is used by WrapperRSA for payload encrypted with RSA-OAEP directly.
+const cipherRSAOAEP Cipher = 0x80
+
+// Compression is an identifier of the compression algorithm.
+type Compression uint8
+
+// Compressions supported.
+const (
+	CompressionNone Compression = iota
+	CompressionLZ4
+)
+
+// Header flags.
+const (
+	// flagWrappedKey means the data key wrapped by KeyProvider is stored with the data.
+	flagWrappedKey uint32 = 1 << iota
+	// flagPadded means the payload is padded to hide its length.
+	flagPadded
+	// flagCommitted means the ciphertext is key-committing.
+	flagCommitted
+	// flagDeterministic means the envelope has no random parts so the same input produces the same output.
+	flagDeterministic
+	// flagConvergent means the data is encrypted with the content key stored wrapped with the tenant key.
+	flagConvergent
+	// flagSeekable means the encrypted stream has the trailer and could be read at random.
+	flagSeekable
+	// flagChunked means the payload is split to the chunks encrypted independently.
+	flagChunked
+)
+
+// Errors might be returned in case of unexpected header found in the serialized data.
+var (
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	ErrUnknownCompression = errors.New("unknown compression")
+	ErrInvalidHeader      = errors.New("invalid header")
+)
+
+// header describes the way the envelope was produced.
+// Canonical form of the header is authenticated by AEAD ciphers.
+type header struct {
+	Version     uint8
+	Cipher      Cipher
+	Compression Compression
+	KeyID       []byte
+	Flags       uint32
+	IssuedAt    int64
+	NotBefore   int64
+	ExpiresAt   int64
+	ID          []byte
+}
+
+// legacyHeader returns the header describing header-less data.
+func legacyHeader(c Cipher) *header {
+	return &header{Version: versionLegacy, Cipher: c}
+}
+
+func (h *header) validate() error {
+	if h.Version > versionCurrent {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.Version)
+	}
+
+	if h.Compression > CompressionLZ4 {
+		return fmt.Errorf("%w: %d", ErrUnknownCompression, h.Compression)
+	}
+
+	if len(h.KeyID) > math.MaxUint16 || len(h.ID) > math.MaxUint16 {
+		return fmt.Errorf("%w: key ID or envelope ID is too long", ErrInvalidHeader)
+	}
+
+	return nil
+}
+
+// additionalData returns the canonical form of the header to be authenticated.
+// Legacy header is never authenticated so nil is returned for it.
+func (h *header) additionalData() []byte {
+	if h.Version == versionLegacy {
+		return nil
+	}
+
+	buf := make([]byte, 0, 35+len(h.KeyID)+len(h.ID)) // nolint: gomnd
+
+	buf = append(buf, h.Version, byte(h.Cipher), byte(h.Compression))
+	buf = binary.BigEndian.AppendUint32(buf, h.Flags)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.KeyID)))
+	buf = append(buf, h.KeyID...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.IssuedAt))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.NotBefore))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.ExpiresAt))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.ID)))
+	buf = append(buf, h.ID...)
+
+	return buf
+}
+
+func compression(compress bool) Compression {
+	if compress {
+		return CompressionLZ4
+	}
+
+	return CompressionNone
+}
+
+// encrypt encrypts the data with the cipher and options described by the header.
+// Header and associated data provided are authenticated.
+func (h *header) encrypt(data, key, iv, associatedData []byte) ([]byte, error) {
+	if h.Flags&flagCommitted != 0 {
+		return commitEncrypt(h.Cipher, data, key, iv, h.bind(associatedData))
+	}
+
+	return h.Cipher.encrypt(data, key, iv, h.bind(associatedData))
+}
+
+// decrypt decrypts the data with the cipher and options described by the header.
+func (h *header) decrypt(data, key, iv, associatedData []byte) ([]byte, error) {
+	if h.Flags&flagCommitted != 0 {
+		return commitDecrypt(h.Cipher, data, key, iv, h.bind(associatedData))
+	}
+
+	return h.Cipher.decrypt(data, key, iv, h.bind(associatedData))
+}
@@ -0,0 +1,55 @@
+package cryptowrap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+)
+
+// keyIDSize is the length of the key fingerprint.
+const keyIDSize = 8
+
+var keyIDInfo = []byte("cryptowrap key id") // nolint: gochecknoglobals
+
+// KeyFingerprint returns the identifier derived from the symmetric key.
+// Fingerprint is a truncated HMAC so the key could not be recovered from it.
+func KeyFingerprint(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(keyIDInfo) // nolint: errcheck
+
+	return mac.Sum(nil)[:keyIDSize]
+}
+
+// PublicKeyFingerprint returns the identifier derived from the RSA public key.
+func PublicKeyFingerprint(key *rsa.PublicKey) []byte {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+
+	return sum[:keyIDSize]
+}
+
+// keyOrder returns the indexes of the keys to be tried to decrypt the data with key id provided.
+// Only the keys matching the id are returned if any.
+// All the keys are returned if id is empty (legacy data or no key hint) or there is no key matching.
+func keyOrder(n int, id []byte, keyID func(int) []byte) []int {
+	order := make([]int, 0, n)
+
+	if len(id) > 0 {
+		for i := 0; i < n; i++ {
+			if bytes.Equal(keyID(i), id) {
+				order = append(order, i)
+			}
+		}
+
+		if len(order) > 0 {
+			return order
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		order = append(order, i)
+	}
+
+	return order
+}
@@ -0,0 +1,189 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	key := randBytes(16)
+
+	if !bytes.Equal(cryptowrap.KeyFingerprint(key), cryptowrap.KeyFingerprint(key)) {
+		t.Error("fingerprint is not stable")
+	}
+
+	if bytes.Equal(cryptowrap.KeyFingerprint(key), cryptowrap.KeyFingerprint(randBytes(16))) {
+		t.Error("fingerprints of different keys are equal")
+	}
+}
+
+func TestWrapperKeyHintJSON(t *testing.T) {
+	testWrapperKeyHint(t, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperKeyHintMsgp(t *testing.T) {
+	testWrapperKeyHint(t, binMarshal, binUnmarshal)
+}
+
+func testWrapperKeyHint(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(16), randBytes(16), randBytes(16)}
+	orig := TestData{Field1: "Field1"}
+
+	// derived identifiers
+	data, err := marshaler(&cryptowrap.Wrapper{Keys: keys[2:], Payload: &orig, KeyHint: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	// explicit identifiers
+	data, err = marshaler(&cryptowrap.Wrapper{
+		Keys:    keys[1:],
+		KeyIDs:  [][]byte{[]byte("key-1")},
+		Payload: &orig,
+		KeyHint: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst = cryptowrap.Wrapper{
+		Keys:    keys,
+		KeyIDs:  [][]byte{[]byte("key-0"), []byte("key-1"), []byte("key-2")},
+		Payload: &TestData{},
+	}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	// no key matching the identifier: trial decryption
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// matching key is the only one tried
+	err = unmarshaler(data, &cryptowrap.Wrapper{
+		Keys:    keys,
+		KeyIDs:  [][]byte{[]byte("key-1"), []byte("key-0"), []byte("key-2")},
+		Payload: &TestData{},
+	})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperRSAKeyHint(t *testing.T) {
+	initKeys.Do(testKeysInit)
+
+	orig := TestData{Field1: "Field1"}
+
+	data, err := json.Marshal(&cryptowrap.WrapperRSA{
+		EncKeys: []*rsa.PublicKey{&testKeys2048[0].PublicKey, &testKeys2048[1].PublicKey},
+		Payload: &orig,
+		KeyHint: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyID := base64.StdEncoding.EncodeToString(cryptowrap.PublicKeyFingerprint(&testKeys2048[1].PublicKey))
+	if !bytes.Contains(data, []byte(keyID)) {
+		t.Error("key id is not stored")
+	}
+
+	dst := cryptowrap.WrapperRSA{
+		DecKeys: []*rsa.PrivateKey{testKeys4096[0], testKeys2048[1]},
+		Payload: &TestData{},
+	}
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+}
+
+func TestWrapperKeyIndex(t *testing.T) {
+	keys := [][]byte{randBytes(16), randBytes(16), randBytes(16)}
+
+	for i := range keys {
+		data, err := json.Marshal(&cryptowrap.Wrapper{Keys: keys[i:], Payload: &TestData{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}}
+
+		err = json.Unmarshal(data, &dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dst.KeyIndex() != i {
+			t.Errorf("unexpected key index: %d, expected %d", dst.KeyIndex(), i)
+		}
+
+		if !bytes.Equal(dst.KeyID(), cryptowrap.KeyFingerprint(keys[i])) {
+			t.Error("unexpected key id")
+		}
+
+		if dst.Stale() != (i > 0) {
+			t.Errorf("unexpected stale flag for key %d", i)
+		}
+	}
+}
+
+func TestWrapperRSAKeyIndex(t *testing.T) {
+	initKeys.Do(testKeysInit)
+
+	data, err := json.Marshal(&cryptowrap.WrapperRSA{EncKey: &testKeys2048[1].PublicKey, Payload: &TestData{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.WrapperRSA{DecKeys: testKeys2048, Payload: &TestData{}}
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dst.KeyIndex() != 1 || !dst.Stale() {
+		t.Errorf("unexpected key index: %d", dst.KeyIndex())
+	}
+
+	if !bytes.Equal(dst.KeyID(), cryptowrap.PublicKeyFingerprint(&testKeys2048[1].PublicKey)) {
+		t.Error("unexpected key id")
+	}
+}
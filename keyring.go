@@ -0,0 +1,237 @@
+package cryptowrap
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// KeyState is a lifecycle state of the key in KeyRing.
+type KeyState uint8
+
+// Key states.
+const (
+	// KeyDisabled key is never used.
+	KeyDisabled KeyState = iota
+	// KeyDecryptOnly key is used to decrypt the data only, normally it is a former primary key.
+	KeyDecryptOnly
+	// KeyActive key is used to decrypt the data and could be promoted to primary one.
+	// Add the key as active first and rotate to it after all the readers got it.
+	KeyActive
+	// KeyPrimary key is used to encrypt the data. There is only one primary key in the ring.
+	KeyPrimary
+)
+
+// Errors might be returned by KeyRing.
+var (
+	ErrKeyExists     = errors.New("key already exists")
+	ErrKeyNotFound   = errors.New("key not found")
+	ErrKeyDisabled   = errors.New("key is disabled")
+	ErrKeyPrimary    = errors.New("primary key could not be retired")
+	ErrNoPrimaryKey  = errors.New("no primary key")
+	ErrInvalidKeyRSA = errors.New("invalid RSA key")
+)
+
+// KeyEntry is a key stored in KeyRing.
+// Secret is used by Wrapper and Private is used by WrapperRSA.
+type KeyEntry struct {
+	ID      string
+	State   KeyState
+	Secret  []byte
+	Private *rsa.PrivateKey
+}
+
+// KeyRing is a set of keys with their lifecycle states shared by Wrapper and WrapperRSA.
+//
+// Primary key is used to encrypt the data.
+// Primary, active and decrypt-only keys are used to decrypt the data, primary one is tried first.
+// Disabled keys are never used.
+//
+// KeyRing is safe for concurrent use.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys []KeyEntry
+}
+
+// NewKeyRing returns a new KeyRing with the keys provided.
+func NewKeyRing(keys ...KeyEntry) (*KeyRing, error) {
+	ring := &KeyRing{}
+
+	for _, key := range keys {
+		if err := ring.add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return ring, nil
+}
+
+// Add adds symmetric key to be used by Wrapper.
+// If state is KeyPrimary the current primary key will become decrypt-only one.
+func (r *KeyRing) Add(id string, secret []byte, state KeyState) error {
+	return r.add(KeyEntry{ID: id, State: state, Secret: secret})
+}
+
+// AddRSA adds RSA private key to be used by WrapperRSA.
+// If state is KeyPrimary the current primary key will become decrypt-only one.
+func (r *KeyRing) AddRSA(id string, key *rsa.PrivateKey, state KeyState) error {
+	if key == nil {
+		return ErrInvalidKeyRSA
+	}
+
+	return r.add(KeyEntry{ID: id, State: state, Private: key})
+}
+
+// Rotate makes the key with id provided the primary one.
+// The current primary key will become decrypt-only one.
+func (r *KeyRing) Rotate(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+
+	if r.keys[i].State == KeyDisabled {
+		return fmt.Errorf("%w: %s", ErrKeyDisabled, id)
+	}
+
+	r.demote(r.keys[i].Secret != nil)
+	r.keys[i].State = KeyPrimary
+
+	return nil
+}
+
+// Retire disables the key with id provided so it will never be used.
+// Primary key could not be retired, rotate to another key first.
+func (r *KeyRing) Retire(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, id)
+	}
+
+	if r.keys[i].State == KeyPrimary {
+		return fmt.Errorf("%w: %s", ErrKeyPrimary, id)
+	}
+
+	r.keys[i].State = KeyDisabled
+
+	return nil
+}
+
+// Keys returns a copy of the keys stored.
+func (r *KeyRing) Keys() []KeyEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]KeyEntry(nil), r.keys...)
+}
+
+func (r *KeyRing) add(key KeyEntry) error {
+	if key.Secret == nil && key.Private == nil {
+		return ErrNoKey
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.find(key.ID) >= 0 {
+		return fmt.Errorf("%w: %s", ErrKeyExists, key.ID)
+	}
+
+	if key.State == KeyPrimary {
+		r.demote(key.Secret != nil)
+	}
+
+	r.keys = append(r.keys, key)
+
+	return nil
+}
+
+// find returns the index of the key with id provided or -1. Must be called under the lock.
+func (r *KeyRing) find(id string) int {
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// demote makes the primary key of the same kind (symmetric or RSA) decrypt-only. Must be called under the lock.
+func (r *KeyRing) demote(symmetric bool) {
+	for i := range r.keys {
+		if r.keys[i].State == KeyPrimary && (r.keys[i].Secret != nil) == symmetric {
+			r.keys[i].State = KeyDecryptOnly
+		}
+	}
+}
+
+// symmetric returns the symmetric keys to be used for decryption, primary one first.
+func (r *KeyRing) symmetric() *keySet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := &keySet{}
+
+	for _, state := range []KeyState{KeyPrimary, KeyActive, KeyDecryptOnly} {
+		for _, key := range r.keys {
+			if key.State != state || key.Secret == nil {
+				continue
+			}
+
+			set.primary = set.primary || state == KeyPrimary
+			set.keys = append(set.keys, key.Secret)
+			set.ids = append(set.ids, []byte(key.ID))
+		}
+	}
+
+	return set
+}
+
+// private returns the RSA keys to be used for decryption, primary one first.
+// Second value reports the first key is the primary one.
+func (r *KeyRing) private() ([]*rsa.PrivateKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		keys    []*rsa.PrivateKey
+		primary bool
+	)
+
+	for _, state := range []KeyState{KeyPrimary, KeyActive, KeyDecryptOnly} {
+		for _, key := range r.keys {
+			if key.State != state || key.Private == nil {
+				continue
+			}
+
+			primary = primary || state == KeyPrimary
+			keys = append(keys, key.Private)
+		}
+	}
+
+	return keys, primary
+}
+
+// keySet is a set of symmetric keys with their identifiers used by Wrapper.
+type keySet struct {
+	keys    [][]byte
+	ids     [][]byte
+	primary bool
+}
+
+// id returns the identifier of the i-th key: explicit one or derived otherwise.
+func (s *keySet) id(i int) []byte {
+	if i < len(s.ids) && len(s.ids[i]) > 0 {
+		return s.ids[i]
+	}
+
+	return KeyFingerprint(s.keys[i])
+}
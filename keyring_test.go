@@ -0,0 +1,204 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestKeyRingLifecycle(t *testing.T) {
+	ring, err := cryptowrap.NewKeyRing(
+		cryptowrap.KeyEntry{ID: "k1", State: cryptowrap.KeyPrimary, Secret: randBytes(16)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ring.Add("k2", randBytes(16), cryptowrap.KeyActive); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ring.Add("k2", randBytes(16), cryptowrap.KeyActive); !errors.Is(err, cryptowrap.ErrKeyExists) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err = ring.Rotate("k3"); !errors.Is(err, cryptowrap.ErrKeyNotFound) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err = ring.Rotate("k2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ring.Retire("k2"); !errors.Is(err, cryptowrap.ErrKeyPrimary) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err = ring.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ring.Rotate("k1"); !errors.Is(err, cryptowrap.ErrKeyDisabled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	states := make(map[string]cryptowrap.KeyState)
+	for _, key := range ring.Keys() {
+		states[key.ID] = key.State
+	}
+
+	expected := map[string]cryptowrap.KeyState{"k1": cryptowrap.KeyDisabled, "k2": cryptowrap.KeyPrimary}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("unexpected states: %v", states)
+	}
+}
+
+func TestWrapperKeyRing(t *testing.T) {
+	ring, err := cryptowrap.NewKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := TestData{Field1: "Field1"}
+
+	_, err = json.Marshal(&cryptowrap.Wrapper{KeyRing: ring, Payload: &orig})
+	if !errors.Is(err, cryptowrap.ErrNoKey) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err = ring.Add("k1", randBytes(16), cryptowrap.KeyActive); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = json.Marshal(&cryptowrap.Wrapper{KeyRing: ring, Payload: &orig})
+	if !errors.Is(err, cryptowrap.ErrNoPrimaryKey) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err = ring.Rotate("k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{KeyRing: ring, Payload: &orig, KeyHint: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ring.Add("k2", randBytes(16), cryptowrap.KeyPrimary); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.Wrapper{KeyRing: ring, Payload: &TestData{}}
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	if !dst.Stale() || string(dst.KeyID()) != "k1" {
+		t.Errorf("unexpected key used: %d %s", dst.KeyIndex(), dst.KeyID())
+	}
+
+	if err = ring.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{KeyRing: ring, Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperKeyRingConcurrent(t *testing.T) {
+	ring, err := cryptowrap.NewKeyRing(
+		cryptowrap.KeyEntry{ID: "k0", State: cryptowrap.KeyPrimary, Secret: randBytes(16)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				data, err := json.Marshal(&cryptowrap.Wrapper{KeyRing: ring, Payload: &TestData{}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				err = json.Unmarshal(data, &cryptowrap.Wrapper{KeyRing: ring, Payload: &TestData{}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 1; i < 20; i++ {
+		if err = ring.Add(fmt.Sprintf("k%d", i), randBytes(16), cryptowrap.KeyPrimary); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wg.Wait()
+}
+
+func TestWrapperRSAKeyRing(t *testing.T) {
+	initKeys.Do(testKeysInit)
+
+	ring, err := cryptowrap.NewKeyRing(
+		cryptowrap.KeyEntry{ID: "r0", State: cryptowrap.KeyPrimary, Private: testKeys2048[0]},
+		cryptowrap.KeyEntry{ID: "s0", State: cryptowrap.KeyPrimary, Secret: randBytes(16)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := TestData{Field1: "Field1"}
+
+	data, err := json.Marshal(&cryptowrap.WrapperRSA{KeyRing: ring, Payload: &orig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ring.AddRSA("r1", testKeys2048[1], cryptowrap.KeyPrimary); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.WrapperRSA{KeyRing: ring, Payload: &TestData{}}
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	if dst.KeyIndex() != 1 || !dst.Stale() {
+		t.Errorf("unexpected key index: %d", dst.KeyIndex())
+	}
+
+	for _, key := range ring.Keys() {
+		if key.ID == "s0" && key.State != cryptowrap.KeyPrimary {
+			t.Error("symmetric primary key demoted by RSA one")
+		}
+	}
+}
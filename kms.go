@@ -0,0 +1,107 @@
+package cryptowrap
+
+import (
+	"context"
+	"errors"
+)
+
+// dataKeySize is the length of the data key generated for every message encrypted with KeyProvider.
+const dataKeySize = 32
+
+// ErrNoKeyProvider might be returned in case of data with wrapped data key found but no KeyProvider provided.
+var ErrNoKeyProvider = errors.New("key provider has to be provided")
+
+// KeyProvider is an interface of the master key storage (KMS, HSM etc) used for envelope encryption.
+//
+// Wrapper will generate a random data key for every message, encrypt the payload with it
+// and store the data key wrapped by KeyProvider with the serialized data.
+type KeyProvider interface {
+	// WrapKey encrypts the data key with the master key.
+	WrapKey(ctx context.Context, key []byte) ([]byte, error)
+	// UnwrapKey decrypts the data key encrypted by WrapKey.
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// MemoryKeyProvider is a KeyProvider keeping the master key in memory.
+// Data keys are wrapped with AES-GCM. Intended to be used for tests mostly.
+type MemoryKeyProvider struct {
+	master []byte
+}
+
+// NewMemoryKeyProvider returns a new MemoryKeyProvider with the AES master key provided.
+func NewMemoryKeyProvider(master []byte) (*MemoryKeyProvider, error) {
+	if _, err := CipherAESGCM.aead(master); err != nil {
+		return nil, err
+	}
+
+	return &MemoryKeyProvider{master: master}, nil
+}
+
+// WrapKey encrypts the data key with the master key.
+func (p *MemoryKeyProvider) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	iv := randBytes(12) // nolint: gomnd
+
+	wrapped, err := CipherAESGCM.encrypt(key, p.master, iv, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(iv, wrapped...), nil
+}
+
+// UnwrapKey decrypts the data key encrypted by WrapKey.
+func (p *MemoryKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < 12 { // nolint: gomnd
+		return nil, ErrUndecryptable
+	}
+
+	key, err := CipherAESGCM.decrypt(wrapped[12:], p.master, wrapped[:12], nil)
+	if err != nil {
+		return nil, ErrUndecryptable
+	}
+
+	return key, nil
+}
+
+// context returns the context to be passed to KeyProvider.
+func (w *Wrapper) context() context.Context {
+	if w.Context != nil {
+		return w.Context
+	}
+
+	return context.Background()
+}
+
+// newDataKey generates a new data key and wraps it with KeyProvider.
+func (w *Wrapper) newDataKey() (*keySet, []byte, error) {
+	key := randBytes(dataKeySize)
+
+	wrapped, err := w.KeyProvider.WrapKey(w.context(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &keySet{keys: [][]byte{key}, primary: true}, wrapped, nil
+}
+
+// unwrapDataKey unwraps the data key with KeyProvider.
+func (w *Wrapper) unwrapDataKey(wrapped []byte) (*keySet, error) {
+	if w.KeyProvider == nil {
+		return nil, ErrNoKeyProvider
+	}
+
+	key, err := w.KeyProvider.UnwrapKey(w.context(), wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keySet{keys: [][]byte{key}, primary: true}, nil
+}
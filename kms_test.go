@@ -0,0 +1,92 @@
+package cryptowrap_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperKeyProviderJSON(t *testing.T) {
+	testWrapperKeyProvider(t, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperKeyProviderGob(t *testing.T) {
+	testWrapperKeyProvider(t, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperKeyProviderMsgp(t *testing.T) {
+	testWrapperKeyProvider(t, binMarshal, binUnmarshal)
+}
+
+func testWrapperKeyProvider(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	provider, err := cryptowrap.NewMemoryKeyProvider(randBytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := TestData{Field1: "Field1", Field2: "Field2"}
+
+	data, err := marshaler(&cryptowrap.Wrapper{
+		KeyProvider: provider,
+		Payload:     &orig,
+		Cipher:      cryptowrap.CipherXChaCha20Poly1305,
+		Compress:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.Wrapper{KeyProvider: provider, Payload: &TestData{}}
+
+	err = unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: [][]byte{randBytes(32)}, Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrNoKeyProvider) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	other, err := cryptowrap.NewMemoryKeyProvider(randBytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{KeyProvider: other, Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperKeyProviderContext(t *testing.T) {
+	provider, err := cryptowrap.NewMemoryKeyProvider(randBytes(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = json.Marshal(&cryptowrap.Wrapper{KeyProvider: provider, Context: ctx, Payload: &TestData{}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = cryptowrap.NewMemoryKeyProvider(randBytes(15))
+	if err == nil {
+		t.Error("invalid master key accepted")
+	}
+}
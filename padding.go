@@ -0,0 +1,110 @@
+package cryptowrap
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// paddingMarker separates the payload and the padding (ISO/IEC 7816-4 padding).
+const paddingMarker = 0x80
+
+// ErrInvalidPadding might be returned in case of padded data malformed.
+var ErrInvalidPadding = errors.New("invalid padding")
+
+// PaddingPolicy decides the length the payload is padded to before encryption,
+// so the ciphertext length does not leak the exact payload length.
+type PaddingPolicy interface {
+	// PaddedSize returns the padded length for the length provided, it must not be less than the length provided.
+	PaddedSize(n int) int
+}
+
+// PaddingFunc is an adapter to use ordinary function as a PaddingPolicy.
+type PaddingFunc func(n int) int
+
+// PaddedSize calls f(n).
+func (f PaddingFunc) PaddedSize(n int) int {
+	return f(n)
+}
+
+// PadBuckets returns the PaddingPolicy padding the payload to the nearest bucket size provided.
+// Payloads larger than the largest bucket are padded to the multiple of the largest bucket.
+func PadBuckets(sizes ...int) PaddingPolicy {
+	buckets := append([]int(nil), sizes...)
+	sort.Ints(buckets)
+
+	return PaddingFunc(func(n int) int {
+		if len(buckets) == 0 || buckets[len(buckets)-1] <= 0 {
+			return n
+		}
+
+		for _, size := range buckets {
+			if size >= n {
+				return size
+			}
+		}
+
+		largest := buckets[len(buckets)-1]
+
+		return (n + largest - 1) / largest * largest
+	})
+}
+
+// PadPowerOfTwo returns the PaddingPolicy padding the payload to the nearest power of two.
+// Overhead is up to 100%.
+func PadPowerOfTwo() PaddingPolicy {
+	return PaddingFunc(func(n int) int {
+		if n <= 1 {
+			return 1
+		}
+
+		return 1 << bits.Len(uint(n-1))
+	})
+}
+
+// PadPadme returns the PaddingPolicy implementing Padmé padding
+// (see "Reducing Metadata Leakage from Encrypted Files and Communication with PURBs").
+// Overhead is up to 12%, leakage is O(log log n) bits.
+func PadPadme() PaddingPolicy {
+	return PaddingFunc(func(n int) int {
+		if n <= 2 { // nolint: gomnd
+			return n
+		}
+
+		e := bits.Len(uint(n)) - 1
+		s := bits.Len(uint(e))
+		mask := 1<<(e-s) - 1
+
+		return (n + mask) &^ mask
+	})
+}
+
+// pad appends the marker and zero bytes so the result length is as the policy requires.
+func pad(data []byte, policy PaddingPolicy) []byte {
+	size := policy.PaddedSize(len(data) + 1)
+	if size < len(data)+1 {
+		size = len(data) + 1
+	}
+
+	padded := make([]byte, size)
+	copy(padded, data)
+	padded[len(data)] = paddingMarker
+
+	return padded
+}
+
+// unpad removes the padding appended by pad.
+func unpad(data []byte) ([]byte, error) {
+	for i := len(data) - 1; i >= 0; i-- {
+		switch data[i] {
+		case 0:
+			continue
+		case paddingMarker:
+			return data[:i], nil
+		default:
+			return nil, ErrInvalidPadding
+		}
+	}
+
+	return nil, ErrInvalidPadding
+}
@@ -0,0 +1,78 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestPaddingPolicies(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		policy   cryptowrap.PaddingPolicy
+		in, want []int
+	}{
+		{"buckets", cryptowrap.PadBuckets(256, 64, 1024), []int{1, 64, 65, 1000, 1025, 3000}, []int{64, 64, 256, 1024, 2048, 3072}},
+		{"power of two", cryptowrap.PadPowerOfTwo(), []int{1, 2, 3, 64, 65, 1000}, []int{1, 2, 4, 64, 128, 1024}},
+		{"padme", cryptowrap.PadPadme(), []int{1, 9, 100, 1000, 1024, 1025}, []int{1, 10, 104, 1024, 1024, 1088}},
+	} {
+		for i, n := range c.in {
+			if got := c.policy.PaddedSize(n); got != c.want[i] {
+				t.Errorf("%s: unexpected padded size for %d: %d, expected %d", c.name, n, got, c.want[i])
+			}
+		}
+	}
+}
+
+func TestWrapperPaddingJSON(t *testing.T) {
+	testWrapperPadding(t, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperPaddingMsgp(t *testing.T) {
+	testWrapperPadding(t, binMarshal, binUnmarshal)
+}
+
+func testWrapperPadding(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(16)}
+
+	lengths := make([]int, 0, 2)
+
+	for _, field := range []string{"a", strings.Repeat("a", 100)} {
+		orig := TestData{Field1: field}
+
+		data, err := marshaler(&cryptowrap.Wrapper{
+			Keys:    keys,
+			Payload: &orig,
+			Cipher:  cryptowrap.CipherAESGCM,
+			Padding: cryptowrap.PadBuckets(512),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lengths = append(lengths, len(data))
+
+		dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}}
+
+		err = unmarshaler(data, &dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(&orig, dst.Payload) {
+			t.Error("decrypted is not equal to original")
+		}
+	}
+
+	// checksum encoding length may vary a bit
+	if lengths[1]-lengths[0] > 8 || lengths[0]-lengths[1] > 8 {
+		t.Errorf("payload length leaked: %v", lengths)
+	}
+}
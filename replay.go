@@ -0,0 +1,127 @@
+package cryptowrap
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// envelopeIDSize is the length of the unique identifier of the envelope.
+const envelopeIDSize = 16
+
+// Errors might be returned by Unmarshaler with ReplayGuard provided.
+var (
+	ErrReplay = errors.New("data has been seen before")
+	ErrNoID   = errors.New("data has no unique identifier")
+)
+
+// ErrNoExpiry is returned by MemoryReplayGuard for the data with no expiration time.
+var ErrNoExpiry = errors.New("data has no expiration time")
+
+// defaultCleanupInterval is used by MemoryReplayGuard with no CleanupInterval provided.
+const defaultCleanupInterval = time.Minute
+
+// ReplayGuard records the unique identifiers of the data decrypted to reject the data seen before.
+type ReplayGuard interface {
+	// Seen records the identifier and reports whether it has been recorded before.
+	// The identifier could be forgotten after expiresAt, zero expiresAt means the data never expires.
+	Seen(id []byte, expiresAt time.Time) (bool, error)
+}
+
+// MemoryReplayGuard is an in-memory ReplayGuard keeping the identifiers until the data expiration time.
+// The data never expiring is rejected with ErrNoExpiry, so ExpiresAt or TTL must be set for the data
+// and the memory used is bounded by the data lifetime.
+// Expired identifiers are removed not more often than once per CleanupInterval (one minute by default).
+// Clock is used to get the current time, time.Now by default.
+//
+// Zero value is ready to use. MemoryReplayGuard is safe for concurrent use.
+type MemoryReplayGuard struct {
+	CleanupInterval time.Duration
+	Clock           func() time.Time
+
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	cleaned time.Time
+}
+
+// NewMemoryReplayGuard returns a new MemoryReplayGuard removing the expired identifiers once per cleanupInterval.
+func NewMemoryReplayGuard(cleanupInterval time.Duration) *MemoryReplayGuard {
+	return &MemoryReplayGuard{CleanupInterval: cleanupInterval}
+}
+
+// Seen records the identifier and reports whether it has been recorded before.
+// ErrNoExpiry is returned if expiresAt is zero.
+func (g *MemoryReplayGuard) Seen(id []byte, expiresAt time.Time) (bool, error) {
+	if expiresAt.IsZero() {
+		return false, ErrNoExpiry
+	}
+
+	now := time.Now()
+	if g.Clock != nil {
+		now = g.Clock()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.seen == nil {
+		g.seen = make(map[string]time.Time)
+	}
+
+	g.clean(now)
+
+	if until, ok := g.seen[string(id)]; ok && now.Before(until) {
+		return true, nil
+	}
+
+	g.seen[string(id)] = expiresAt
+
+	return false, nil
+}
+
+// clean removes the expired identifiers, not more often than once per CleanupInterval. Must be called under the lock.
+func (g *MemoryReplayGuard) clean(now time.Time) {
+	interval := g.CleanupInterval
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+
+	if now.Sub(g.cleaned) < interval {
+		return
+	}
+
+	for id, until := range g.seen {
+		if !now.Before(until) {
+			delete(g.seen, id)
+		}
+	}
+
+	g.cleaned = now
+}
+
+// checkReplay records the identifier of the authenticated header with ReplayGuard.
+// Identifier could be forged unless authenticated so plain AES-CBC is not accepted.
+func (w *Wrapper) checkReplay(h *header) error {
+	if w.ReplayGuard == nil {
+		return nil
+	}
+
+	if !h.Cipher.authenticated() {
+		return ErrNotAuthenticated
+	}
+
+	if len(h.ID) == 0 {
+		return ErrNoID
+	}
+
+	seen, err := w.ReplayGuard.Seen(h.ID, timeUnix(h.ExpiresAt))
+	if err != nil {
+		return err
+	}
+
+	if seen {
+		return ErrReplay
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperReplayGuardJSON(t *testing.T) {
+	testWrapperReplayGuard(t, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperReplayGuardMsgp(t *testing.T) {
+	testWrapperReplayGuard(t, binMarshal, binUnmarshal)
+}
+
+func testWrapperReplayGuard(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(32)}
+	guard := cryptowrap.NewMemoryReplayGuard(time.Hour)
+
+	src := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Cipher: cryptowrap.CipherChaCha20Poly1305, TTL: time.Hour}
+
+	data, err := marshaler(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, ReplayGuard: guard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, ReplayGuard: guard})
+	if !errors.Is(err, cryptowrap.ErrReplay) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	data, err = marshaler(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, ReplayGuard: guard})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrapperReplayGuardNotAuthenticated(t *testing.T) {
+	keys := [][]byte{randBytes(16)}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guard := cryptowrap.NewMemoryReplayGuard(time.Hour)
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, ReplayGuard: guard})
+	if !errors.Is(err, cryptowrap.ErrNotAuthenticated) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMemoryReplayGuardExpiry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	guard := cryptowrap.NewMemoryReplayGuard(time.Minute)
+	guard.Clock = func() time.Time { return now }
+
+	for _, c := range []struct {
+		id        string
+		expiresAt time.Time
+		seen      bool
+	}{
+		{"a", now.Add(time.Minute), false},
+		{"b", now.Add(time.Hour), false},
+		{"a", now.Add(time.Minute), true},
+		{"b", now.Add(time.Hour), true},
+	} {
+		seen, err := guard.Seen([]byte(c.id), c.expiresAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if seen != c.seen {
+			t.Errorf("unexpected seen for %s: %v", c.id, seen)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if seen, _ := guard.Seen([]byte("a"), now.Add(time.Minute)); seen {
+		t.Error("identifier is not forgotten after the data expiration")
+	}
+
+	if seen, _ := guard.Seen([]byte("b"), now.Add(time.Hour)); !seen {
+		t.Error("identifier is forgotten before the data expiration")
+	}
+}
+
+func TestMemoryReplayGuardNoExpiry(t *testing.T) {
+	var guard cryptowrap.MemoryReplayGuard
+
+	if _, err := guard.Seen([]byte("a"), time.Time{}); !errors.Is(err, cryptowrap.ErrNoExpiry) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if seen, err := guard.Seen([]byte("a"), time.Now().Add(time.Hour)); err != nil || seen {
+		t.Errorf("zero value guard is not usable: %v %v", seen, err)
+	}
+
+	keys := [][]byte{randBytes(32)}
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, Cipher: cryptowrap.CipherAESGCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, ReplayGuard: &guard})
+	if !errors.Is(err, cryptowrap.ErrNoExpiry) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package cryptowrap
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrRewrapDeterministic is returned if the data is rewrapped to the deterministic or convergent Wrapper:
+// rewrapped payload keeps the random parts of the original one, so the result could not be deterministic.
+var ErrRewrapDeterministic = errors.New("rewrapped data could not be deterministic")
+
+// RewrapJSON re-encrypts the data produced by MarshalJSON without deserializing the payload.
+// The data is decrypted with the keys of w and encrypted with the keys and settings of dst (Payload is ignored).
+// The result is in the same format, so it could replace the original data as is.
+// Timestamps and identifier of the original data are kept: the result expires at the same time
+// and is recognized by ReplayGuard as the original data.
+// ErrRewrapDeterministic is returned if dst is Deterministic or Convergent, unmarshal and marshal the data instead.
+func (w *Wrapper) RewrapJSON(data []byte, dst *Wrapper) ([]byte, error) {
+	return w.rewrap(data, dst, json.Marshal, json.Unmarshal)
+}
+
+// RewrapGob re-encrypts the data produced by GobEncode without deserializing the payload.
+// See RewrapJSON for details.
+func (w *Wrapper) RewrapGob(data []byte, dst *Wrapper) ([]byte, error) {
+	return w.rewrap(data, dst, gobMarshal, gobUnmarshal)
+}
+
+// RewrapBinary re-encrypts the data produced by MarshalBinary without deserializing the payload.
+// See RewrapJSON for details.
+func (w *Wrapper) RewrapBinary(data []byte, dst *Wrapper) ([]byte, error) {
+	return w.rewrap(data, dst, binMarshal, binUnmarshal)
+}
+
+func (w *Wrapper) rewrap(
+	data []byte,
+	dst *Wrapper,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) ([]byte, error) {
+	if dst.deterministic() {
+		return nil, ErrRewrapDeterministic
+	}
+
+	payload, h, err := w.open(data, unmarshaler)
+	if err != nil {
+		return nil, err
+	}
+
+	return dst.seal(payload, h, marshaler)
+}
+
+// RewrapJSON re-encrypts the data produced by MarshalJSON without deserializing the payload.
+// The data is decrypted with the keys of w and encrypted with the keys and settings of dst (Payload is ignored).
+// The result is in the same format, so it could replace the original data as is.
+func (w *WrapperRSA) RewrapJSON(data []byte, dst *WrapperRSA) ([]byte, error) {
+	return w.rewrap(data, dst, json.Marshal, json.Unmarshal)
+}
+
+// RewrapGob re-encrypts the data produced by GobEncode without deserializing the payload.
+// See RewrapJSON for details.
+func (w *WrapperRSA) RewrapGob(data []byte, dst *WrapperRSA) ([]byte, error) {
+	return w.rewrap(data, dst, gobMarshal, gobUnmarshal)
+}
+
+// RewrapBinary re-encrypts the data produced by MarshalBinary without deserializing the payload.
+// See RewrapJSON for details.
+func (w *WrapperRSA) RewrapBinary(data []byte, dst *WrapperRSA) ([]byte, error) {
+	return w.rewrap(data, dst, binMarshal, binUnmarshal)
+}
+
+func (w *WrapperRSA) rewrap(
+	data []byte,
+	dst *WrapperRSA,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) ([]byte, error) {
+	payload, err := w.open(data, unmarshaler)
+	if err != nil {
+		return nil, err
+	}
+
+	return dst.seal(payload, marshaler)
+}
@@ -0,0 +1,191 @@
+package cryptowrap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestWrapperRewrapJSON(t *testing.T) {
+	testWrapperRewrap(
+		t,
+		(*cryptowrap.Wrapper).MarshalJSON,
+		(*cryptowrap.Wrapper).UnmarshalJSON,
+		(*cryptowrap.Wrapper).RewrapJSON,
+	)
+}
+
+func TestWrapperRewrapGob(t *testing.T) {
+	testWrapperRewrap(
+		t,
+		(*cryptowrap.Wrapper).GobEncode,
+		(*cryptowrap.Wrapper).GobDecode,
+		(*cryptowrap.Wrapper).RewrapGob,
+	)
+}
+
+func TestWrapperRewrapMsgp(t *testing.T) {
+	testWrapperRewrap(
+		t,
+		(*cryptowrap.Wrapper).MarshalBinary,
+		(*cryptowrap.Wrapper).UnmarshalBinary,
+		(*cryptowrap.Wrapper).RewrapBinary,
+	)
+}
+
+func testWrapperRewrap(
+	t *testing.T,
+	marshaler func(*cryptowrap.Wrapper) ([]byte, error),
+	unmarshaler func(*cryptowrap.Wrapper, []byte) error,
+	rewrap func(*cryptowrap.Wrapper, []byte, *cryptowrap.Wrapper) ([]byte, error),
+) {
+	oldKey := randBytes(16)
+	newKey := randBytes(32)
+
+	orig := TestData{Field1: "Field1", Field2: "Field2"}
+
+	src := cryptowrap.Wrapper{Keys: [][]byte{oldKey}, Payload: &orig}
+
+	data, err := marshaler(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no payload type required to rewrap
+	data, err = rewrap(
+		&cryptowrap.Wrapper{Keys: [][]byte{oldKey}},
+		data,
+		&cryptowrap.Wrapper{Keys: [][]byte{newKey}, Cipher: cryptowrap.CipherAESGCM, Compress: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = unmarshaler(&cryptowrap.Wrapper{Keys: [][]byte{oldKey}, Payload: &TestData{}}, data)
+	if err == nil {
+		t.Error("decrypted with the old key")
+	}
+
+	dst := cryptowrap.Wrapper{Keys: [][]byte{newKey}, Payload: &TestData{}}
+
+	err = unmarshaler(&dst, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+}
+
+func TestWrapperRSARewrapJSON(t *testing.T) {
+	initKeys.Do(testKeysInit)
+
+	orig := TestData{Field1: "Field1", Field2: "Field2"}
+
+	data, err := json.Marshal(&cryptowrap.WrapperRSA{EncKey: &testKeys2048[0].PublicKey, Payload: &orig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := cryptowrap.WrapperRSA{DecKeys: testKeys2048[:1]}
+
+	data, err = src.RewrapJSON(data, &cryptowrap.WrapperRSA{EncKey: &testKeys2048[1].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.WrapperRSA{DecKeys: testKeys2048[:1], Payload: &TestData{}})
+	if err == nil {
+		t.Error("decrypted with the old key")
+	}
+
+	dst := cryptowrap.WrapperRSA{DecKeys: testKeys2048[1:], Payload: &TestData{}}
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+}
+
+func TestWrapperRewrapExpiring(t *testing.T) {
+	oldKey := randBytes(16)
+	newKey := randBytes(32)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	guard := cryptowrap.NewMemoryReplayGuard(time.Hour)
+	guard.Clock = clock
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{
+		Keys:    [][]byte{oldKey},
+		Payload: &TestData{},
+		Cipher:  cryptowrap.CipherAESGCM,
+		TTL:     time.Hour,
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{
+		Keys:        [][]byte{oldKey},
+		Payload:     &TestData{},
+		ReplayGuard: guard,
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = (&cryptowrap.Wrapper{Keys: [][]byte{oldKey}, Clock: clock}).RewrapJSON(
+		data,
+		&cryptowrap.Wrapper{Keys: [][]byte{newKey}, Cipher: cryptowrap.CipherChaCha20Poly1305},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{
+		Keys:        [][]byte{newKey},
+		Payload:     &TestData{},
+		ReplayGuard: guard,
+		Clock:       clock,
+	})
+	if !errors.Is(err, cryptowrap.ErrReplay) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+
+	err = json.Unmarshal(data, &cryptowrap.Wrapper{Keys: [][]byte{newKey}, Payload: &TestData{}, Clock: clock})
+	if !errors.Is(err, cryptowrap.ErrExpired) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperRewrapDeterministic(t *testing.T) {
+	key := randBytes(32)
+
+	data, err := json.Marshal(&cryptowrap.Wrapper{Keys: [][]byte{key}, Payload: &TestData{}, Cipher: cryptowrap.CipherAESGCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dst := range []*cryptowrap.Wrapper{
+		{Keys: [][]byte{key}, Cipher: cryptowrap.CipherAESSIV, Deterministic: true},
+		{Keys: [][]byte{key}, Cipher: cryptowrap.CipherAESSIV, Convergent: true},
+	} {
+		_, err = (&cryptowrap.Wrapper{Keys: [][]byte{key}}).RewrapJSON(data, dst)
+		if !errors.Is(err, cryptowrap.ErrRewrapDeterministic) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package cryptowrap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// seekableTrailerSize is the length of the seekable stream trailer: the data length.
+const seekableTrailerSize = 8
+
+// Errors might be returned by the seekable reader.
+var (
+	ErrNotSeekable   = errors.New("encrypted stream is not seekable")
+	ErrInvalidOffset = errors.New("invalid offset")
+)
+
+// NewSeekableWriter returns the writer encrypting the data written to dst into the seekable blob:
+// fixed-size chunks authenticated independently followed by the authenticated trailer containing the data length.
+// Blob could be read at random with NewSeekableReader or sequentially with NewDecryptReader.
+//
+// Wrapper provided is used the same way as by NewEncryptWriter.
+// Close must be called to write the trailer. Close does not close dst.
+func NewSeekableWriter(dst io.Writer, w *Wrapper) (io.WriteCloser, error) {
+	return newEncryptWriter(dst, w, flagSeekable)
+}
+
+// SeekableReader decrypts the blob encrypted by NewSeekableWriter at random,
+// only the chunks containing the data requested are read and decrypted.
+// Every chunk is authenticated before the data returned.
+//
+// SeekableReader is safe for concurrent ReadAt calls. Read and Seek share the offset.
+type SeekableReader struct {
+	src        io.ReaderAt
+	cipher     *streamCipher
+	chunkSize  int64
+	sealedSize int64
+	dataOffset int64
+	size       int64
+
+	mu     sync.Mutex
+	pos    int64
+	chunk  int64
+	sealed []byte
+	plain  []byte
+}
+
+// NewSeekableReader returns the reader decrypting the blob of size provided encrypted by NewSeekableWriter.
+//
+// Keys, KeyIDs, KeyRing, KeyProvider, Context and AssociatedData of the Wrapper provided are used,
+// KeyIndex and KeyID of it are set to the key used to decrypt the blob.
+// Trailer is authenticated before the reader returned, so the truncated blob is reported at once.
+func NewSeekableReader(src io.ReaderAt, size int64, w *Wrapper) (*SeekableReader, error) {
+	h, err := readStreamHeader(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Flags&flagSeekable == 0 {
+		return nil, ErrNotSeekable
+	}
+
+	keys, err := w.streamKeys(h)
+	if err != nil {
+		return nil, err
+	}
+
+	header := h.marshal()
+	additionalData := append(header, w.AssociatedData...)
+
+	for _, i := range keyOrder(len(keys.keys), h.KeyID, keys.id) {
+		sc, err := newStreamCipher(h.Cipher, keys.keys[i], h.Salt, additionalData)
+		if err != nil {
+			return nil, err
+		}
+
+		r := &SeekableReader{
+			src:        src,
+			cipher:     sc,
+			chunkSize:  int64(h.ChunkSize),
+			sealedSize: int64(h.ChunkSize) + int64(sc.aead.Overhead()),
+			dataOffset: int64(len(header)),
+			chunk:      -1,
+		}
+
+		if err = r.readTrailer(size); err != nil {
+			if errors.Is(err, ErrUndecryptable) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		w.keyIndex = i
+		w.keyID = keys.id(i)
+
+		return r, nil
+	}
+
+	return nil, ErrUndecryptable
+}
+
+// readTrailer authenticates the trailer and checks the blob length matches the data length.
+func (r *SeekableReader) readTrailer(size int64) error {
+	overhead := r.sealedSize - r.chunkSize
+	trailerOffset := size - seekableTrailerSize - overhead
+
+	if trailerOffset < r.dataOffset {
+		return ErrTruncated
+	}
+
+	sealed := make([]byte, seekableTrailerSize+overhead)
+
+	if err := readFullAt(r.src, sealed, trailerOffset); err != nil {
+		return fmt.Errorf("reading trailer: %w", err)
+	}
+
+	chunks := (trailerOffset - r.dataOffset + r.sealedSize - 1) / r.sealedSize
+
+	trailer, err := r.cipher.open(nil, sealed, uint32(chunks), true)
+	if err != nil {
+		return ErrUndecryptable
+	}
+
+	r.size = int64(binary.BigEndian.Uint64(trailer))
+
+	if r.size < 0 || (r.size+r.chunkSize-1)/r.chunkSize != chunks || r.size+chunks*overhead != trailerOffset-r.dataOffset {
+		return ErrTruncated
+	}
+
+	return nil
+}
+
+// Size returns the length of the data encrypted.
+func (r *SeekableReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) bytes of the data decrypted starting at offset off.
+func (r *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidOffset
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+
+	for n < len(p) && off < r.size {
+		chunk := off / r.chunkSize
+
+		if err := r.load(chunk); err != nil {
+			return n, err
+		}
+
+		copied := copy(p[n:], r.plain[off-chunk*r.chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Read reads the data decrypted starting at the current offset.
+func (r *SeekableReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	return n, err
+}
+
+// Seek sets the offset for the next Read.
+func (r *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, ErrInvalidOffset
+	}
+
+	if offset < 0 {
+		return 0, ErrInvalidOffset
+	}
+
+	r.pos = offset
+
+	return offset, nil
+}
+
+// load reads and decrypts the chunk unless it is loaded already. Must be called under the lock.
+func (r *SeekableReader) load(chunk int64) error {
+	if r.chunk == chunk {
+		return nil
+	}
+
+	length := r.size - chunk*r.chunkSize
+	if length > r.chunkSize {
+		length = r.chunkSize
+	}
+
+	if r.sealed == nil {
+		r.sealed = make([]byte, r.sealedSize)
+		r.plain = make([]byte, 0, r.chunkSize)
+	}
+
+	sealed := r.sealed[:length+r.sealedSize-r.chunkSize]
+
+	if err := readFullAt(r.src, sealed, r.dataOffset+chunk*r.sealedSize); err != nil {
+		return fmt.Errorf("reading chunk: %w", err)
+	}
+
+	plain, err := r.cipher.open(r.plain[:0], sealed, uint32(chunk), false)
+	if err != nil {
+		r.chunk = -1
+
+		return ErrUndecryptable
+	}
+
+	r.plain = plain
+	r.chunk = chunk
+
+	return nil
+}
+
+// seekableSize returns the data length of the seekable blob of size provided
+// calculated from the stream header read from src. The length is not authenticated.
+func seekableSize(src io.Reader, size int64) (int64, error) {
+	h, err := readStreamHeader(src)
+	if err != nil {
+		return 0, err
+	}
+
+	if h.Flags&flagSeekable == 0 {
+		return 0, ErrNotSeekable
+	}
+
+	overhead, err := streamOverhead(h.Cipher)
+	if err != nil {
+		return 0, err
+	}
+
+	data := size - int64(len(h.marshal())) - seekableTrailerSize - overhead
+	if data < 0 {
+		return 0, ErrTruncated
+	}
+
+	sealedSize := int64(h.ChunkSize) + overhead
+	chunks := (data + sealedSize - 1) / sealedSize
+
+	return data - chunks*overhead, nil
+}
+
+// readFullAt reads len(p) bytes at offset off. io.EOF returned with the full read is ignored.
+func readFullAt(src io.ReaderAt, p []byte, off int64) error {
+	n, err := src.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+
+	if err == nil || errors.Is(err, io.EOF) {
+		return ErrTruncated
+	}
+
+	return err
+}
@@ -0,0 +1,139 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+func TestSeekable(t *testing.T) {
+	keys := [][]byte{randBytes(32), randBytes(16)}
+
+	for _, size := range []int{0, 1, streamChunkSize, 3*streamChunkSize + 12345} {
+		plain := randBytes(size)
+		blob := encryptSeekable(t, &cryptowrap.Wrapper{Keys: keys[1:], Cipher: cryptowrap.CipherChaCha20Poly1305}, plain)
+
+		dst := cryptowrap.Wrapper{Keys: keys}
+
+		r, err := cryptowrap.NewSeekableReader(bytes.NewReader(blob), int64(len(blob)), &dst)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+
+		if r.Size() != int64(size) || dst.KeyIndex() != 1 {
+			t.Fatalf("size %d: unexpected size %d", size, r.Size())
+		}
+
+		for i := 0; i < 100 && size > 0; i++ {
+			off := rand.Intn(size)
+			buf := make([]byte, rand.Intn(2*streamChunkSize))
+
+			n, err := r.ReadAt(buf, int64(off))
+			if err != nil && !(errors.Is(err, io.EOF) && off+len(buf) > size) {
+				t.Fatalf("size %d, offset %d: %v", size, off, err)
+			}
+
+			if !bytes.Equal(buf[:n], plain[off:off+n]) {
+				t.Fatalf("size %d, offset %d: decrypted is not equal to original", size, off)
+			}
+		}
+
+		if _, err = r.Seek(-int64(size/2), io.SeekEnd); err != nil {
+			t.Fatal(err)
+		}
+
+		tail, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(tail, plain[size-size/2:]) {
+			t.Errorf("size %d: decrypted tail is not equal to original", size)
+		}
+
+		sequential, err := decryptStream(&dst, blob)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(sequential, plain) {
+			t.Errorf("size %d: decrypted sequentially is not equal to original", size)
+		}
+	}
+}
+
+func TestSeekableTampered(t *testing.T) {
+	src := cryptowrap.Wrapper{Keys: [][]byte{randBytes(16)}, Cipher: cryptowrap.CipherAESGCM}
+	plain := randBytes(3 * streamChunkSize)
+	blob := encryptSeekable(t, &src, plain)
+	headerSize := len(blob) - 4*16 - 8 - len(plain)
+	sealedChunk := streamChunkSize + 16
+
+	tampered := flip(blob, headerSize+sealedChunk+10)
+
+	r, err := cryptowrap.NewSeekableReader(bytes.NewReader(tampered), int64(len(tampered)), &src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 100)
+
+	if _, err = r.ReadAt(buf, 10); err != nil {
+		t.Errorf("intact chunk is not decrypted: %v", err)
+	}
+
+	if _, err = r.ReadAt(buf, streamChunkSize+10); !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated":     blob[:len(blob)-1],
+		"chunk dropped": concat(blob[:headerSize], blob[headerSize+sealedChunk:]),
+		"trailer only":  concat(blob[:headerSize], blob[len(blob)-24:]),
+	} {
+		_, err = cryptowrap.NewSeekableReader(bytes.NewReader(data), int64(len(data)), &src)
+		if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+	}
+
+	if _, err = decryptStream(&src, blob[:len(blob)-24]); err == nil {
+		t.Error("decrypted sequentially with no trailer")
+	}
+
+	if _, err = decryptStream(&src, blob[:headerSize+sealedChunk+100]); !errors.Is(err, cryptowrap.ErrTruncated) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	stream := encryptStream(t, &src, plain)
+
+	_, err = cryptowrap.NewSeekableReader(bytes.NewReader(stream), int64(len(stream)), &src)
+	if !errors.Is(err, cryptowrap.ErrNotSeekable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func encryptSeekable(t *testing.T, src *cryptowrap.Wrapper, plain []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := cryptowrap.NewSeekableWriter(&buf, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
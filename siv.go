@@ -0,0 +1,207 @@
+package cryptowrap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+// ErrInvalidKeySize might be returned in case of the key length is not suitable for the cipher.
+var ErrInvalidKeySize = errors.New("invalid key size")
+
+// sivAEAD is AES-SIV (RFC 5297) deterministic authenticated encryption.
+// Additional data is the first S2V component, nonce (if not empty) is the second one.
+type sivAEAD struct {
+	mac cipher.Block
+	ctr cipher.Block
+}
+
+// NewSIV returns AES-SIV (RFC 5297) AEAD. Key must be 32, 48 or 64 bytes long
+// for AES-SIV-256, AES-SIV-384 and AES-SIV-512 respectively: the first half is a MAC key,
+// the second half is an encryption key.
+//
+// AES-SIV is deterministic: the same plaintext and additional data produce the same ciphertext.
+// Nonce is optional, NonceSize returns 0 but non-empty nonce is accepted too.
+func NewSIV(key []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 32, 48, 64: // nolint: gomnd
+	default:
+		return nil, ErrInvalidKeySize
+	}
+
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, err
+	}
+
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &sivAEAD{mac: mac, ctr: ctr}, nil
+}
+
+// NonceSize returns 0 as the nonce is optional.
+func (s *sivAEAD) NonceSize() int {
+	return 0
+}
+
+// Overhead returns the synthetic IV length.
+func (s *sivAEAD) Overhead() int {
+	return aes.BlockSize
+}
+
+// Seal encrypts and authenticates the plaintext, the synthetic IV is prepended to the ciphertext.
+// Ciphertext is shifted against the plaintext, so the plaintext is copied to allow in-place sealing.
+func (s *sivAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	v := s.s2v(additionalData, nonce, plaintext)
+	plaintext = append([]byte(nil), plaintext...)
+
+	ret, out := sliceForAppend(dst, aes.BlockSize+len(plaintext))
+	copy(out, v)
+	s.xorCTR(out[aes.BlockSize:], plaintext, v)
+
+	return ret
+}
+
+// Open verifies and decrypts the ciphertext produced by Seal.
+// Synthetic IV and the ciphertext are copied to allow in-place opening.
+func (s *sivAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize {
+		return nil, ErrUndecryptable
+	}
+
+	ciphertext = append([]byte(nil), ciphertext...)
+	v := ciphertext[:aes.BlockSize]
+
+	ret, out := sliceForAppend(dst, len(ciphertext)-aes.BlockSize)
+	s.xorCTR(out, ciphertext[aes.BlockSize:], v)
+
+	if subtle.ConstantTimeCompare(v, s.s2v(additionalData, nonce, out)) != 1 {
+		for i := range out {
+			out[i] = 0
+		}
+
+		return nil, ErrUndecryptable
+	}
+
+	return ret, nil
+}
+
+// s2v is the S2V construction of RFC 5297 over additional data, nonce (if any) and plaintext.
+func (s *sivAEAD) s2v(additionalData, nonce, plaintext []byte) []byte {
+	d := cmac(s.mac, make([]byte, aes.BlockSize))
+
+	d = xorBlock(dbl(d), cmac(s.mac, additionalData))
+
+	if len(nonce) > 0 {
+		d = xorBlock(dbl(d), cmac(s.mac, nonce))
+	}
+
+	var t []byte
+
+	if len(plaintext) >= aes.BlockSize {
+		t = append([]byte(nil), plaintext...)
+		tail := t[len(t)-aes.BlockSize:]
+		copy(tail, xorBlock(tail, d))
+	} else {
+		padded := make([]byte, aes.BlockSize)
+		copy(padded, plaintext)
+		padded[len(plaintext)] = paddingMarker
+		t = xorBlock(dbl(d), padded)
+	}
+
+	return cmac(s.mac, t)
+}
+
+// xorCTR encrypts/decrypts src to dst with AES-CTR using the synthetic IV with 31st and 63rd bits cleared.
+func (s *sivAEAD) xorCTR(dst, src, v []byte) {
+	q := append([]byte(nil), v...)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+
+	cipher.NewCTR(s.ctr, q).XORKeyStream(dst, src)
+}
+
+// cmac calculates AES-CMAC (RFC 4493) of the data.
+func cmac(block cipher.Block, data []byte) []byte {
+	k1 := make([]byte, aes.BlockSize)
+	block.Encrypt(k1, k1)
+	k1 = dbl(k1)
+	k2 := dbl(k1)
+
+	n := (len(data) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(data)%aes.BlockSize == 0
+
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, aes.BlockSize)
+	copy(last, data[(n-1)*aes.BlockSize:])
+
+	if complete {
+		last = xorBlock(last, k1)
+	} else {
+		last[len(data)-(n-1)*aes.BlockSize] = paddingMarker
+		last = xorBlock(last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+
+	for i := 0; i < n-1; i++ {
+		x = xorBlock(x, data[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+
+	x = xorBlock(x, last)
+	block.Encrypt(x, x)
+
+	return x
+}
+
+// dbl multiplies the block by x in GF(2^128).
+func dbl(b []byte) []byte {
+	out := make([]byte, len(b))
+
+	var carry byte
+
+	for i := len(b) - 1; i >= 0; i-- {
+		out[i] = b[i]<<1 | carry
+		carry = b[i] >> 7 // nolint: gomnd
+	}
+
+	if carry != 0 {
+		out[len(out)-1] ^= 0x87
+	}
+
+	return out
+}
+
+func xorBlock(a, b []byte) []byte {
+	out := make([]byte, len(a))
+
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+
+	return out
+}
+
+// sliceForAppend extends the slice by n bytes returning the whole slice and the extension.
+func sliceForAppend(in []byte, n int) ([]byte, []byte) {
+	total := len(in) + n
+
+	var head []byte
+
+	if cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+
+	return head, head[len(in):]
+}
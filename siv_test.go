@@ -0,0 +1,220 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+// RFC 5297 Appendix A.1, deterministic authenticated encryption.
+func TestSIVVector(t *testing.T) {
+	key := unhex(t, "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff")
+	ad := unhex(t, "101112131415161718191a1b1c1d1e1f2021222324252627")
+	plaintext := unhex(t, "112233445566778899aabbccddee")
+	expected := unhex(t, "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c")
+
+	aead, err := cryptowrap.NewSIV(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext := aead.Seal(nil, nil, plaintext, ad)
+	if !bytes.Equal(ciphertext, expected) {
+		t.Fatalf("unexpected ciphertext: %x", ciphertext)
+	}
+
+	decrypted, err := aead.Open(nil, nil, ciphertext, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	if _, err = aead.Open(nil, nil, ciphertext, ad); err == nil {
+		t.Error("decrypted tampered data")
+	}
+
+	if _, err = cryptowrap.NewSIV(key[:16]); !errors.Is(err, cryptowrap.ErrInvalidKeySize) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperSIVJSON256(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESSIV, 32, false, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperSIVGob512Compress(t *testing.T) {
+	testWrapperCipher(t, cryptowrap.CipherAESSIV, 64, true, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperDeterministicJSON(t *testing.T) {
+	testWrapperDeterministic(t, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperDeterministicGob(t *testing.T) {
+	testWrapperDeterministic(t, gobMarshal, gobUnmarshal)
+}
+
+func TestWrapperDeterministicMsgp(t *testing.T) {
+	testWrapperDeterministic(t, binMarshal, binUnmarshal)
+}
+
+func testWrapperDeterministic(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	keys := [][]byte{randBytes(32)}
+	orig := TestData{Field1: "user@example.com"}
+
+	encrypt := func(payload *TestData, ad string) []byte {
+		data, err := marshaler(&cryptowrap.Wrapper{
+			Keys:           keys,
+			Payload:        payload,
+			Cipher:         cryptowrap.CipherAESSIV,
+			AssociatedData: []byte(ad),
+			Deterministic:  true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data
+	}
+
+	data := encrypt(&orig, "users.email")
+
+	if !bytes.Equal(data, encrypt(&TestData{Field1: "user@example.com"}, "users.email")) {
+		t.Error("same payload produced different data")
+	}
+
+	if bytes.Equal(data, encrypt(&TestData{Field1: "user@example.org"}, "users.email")) {
+		t.Error("different payloads produced the same data")
+	}
+
+	if bytes.Equal(data, encrypt(&orig, "admins.email")) {
+		t.Error("different associated data produced the same data")
+	}
+
+	dst := cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}, AssociatedData: []byte("users.email")}
+
+	err := unmarshaler(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+
+	err = unmarshaler(data, &cryptowrap.Wrapper{Keys: keys, Payload: &TestData{}})
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrapperDeterministicNegative(t *testing.T) {
+	_, err := json.Marshal(&cryptowrap.Wrapper{
+		Keys:          [][]byte{randBytes(32)},
+		Payload:       &TestData{},
+		Cipher:        cryptowrap.CipherAESGCM,
+		Deterministic: true,
+	})
+	if !errors.Is(err, cryptowrap.ErrNotDeterministic) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestSIVInPlace(t *testing.T) {
+	aead, err := cryptowrap.NewSIV(randBytes(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := randBytes(100)
+	ad := randBytes(10)
+	expected := aead.Seal(nil, nil, plaintext, ad)
+
+	buf := make([]byte, len(plaintext), len(expected))
+	copy(buf, plaintext)
+
+	ciphertext := aead.Seal(buf[:0], nil, buf, ad)
+	if !bytes.Equal(ciphertext, expected) {
+		t.Fatalf("unexpected ciphertext: %x", ciphertext)
+	}
+
+	decrypted, err := aead.Open(ciphertext[:0], nil, ciphertext, ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Error("decrypted is not equal to original")
+	}
+}
+
+func TestWrapperDeterministicMap(t *testing.T) {
+	keys := [][]byte{randBytes(32)}
+	payload := map[string]string{}
+
+	for i := 0; i < 20; i++ {
+		payload[hex.EncodeToString(randBytes(4))] = hex.EncodeToString(randBytes(4))
+	}
+
+	for name, marshaler := range map[string]func(interface{}) ([]byte, error){"json": json.Marshal, "msgp": binMarshal} {
+		for _, convergent := range []bool{false, true} {
+			encrypt := func() []byte {
+				data, err := marshaler(&cryptowrap.Wrapper{
+					Keys:          keys,
+					Payload:       payload,
+					Cipher:        cryptowrap.CipherAESSIV,
+					Deterministic: !convergent,
+					Convergent:    convergent,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return data
+			}
+
+			data := encrypt()
+
+			for i := 0; i < 20; i++ {
+				if !bytes.Equal(data, encrypt()) {
+					t.Fatalf("%s (convergent %v): same map payload produced different data", name, convergent)
+				}
+			}
+		}
+	}
+
+	_, err := gobMarshal(&cryptowrap.Wrapper{
+		Keys:          keys,
+		Payload:       &struct{ Tags map[string]string }{Tags: payload},
+		Cipher:        cryptowrap.CipherAESSIV,
+		Deterministic: true,
+	})
+	if !errors.Is(err, cryptowrap.ErrMapPayload) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
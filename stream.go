@@ -0,0 +1,560 @@
+package cryptowrap
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// nolint: gomnd
+const (
+	// streamChunkSize is the length of the plaintext chunk encrypted by NewEncryptWriter.
+	streamChunkSize = 64 << 10
+	// maxStreamChunkSize limits the memory used by NewDecryptReader for the data from untrusted source.
+	maxStreamChunkSize = 16 << 20
+	// streamSaltSize is the length of the random salt the per-stream key is derived with.
+	streamSaltSize = 32
+	// streamKeySize is the length of the per-stream key.
+	streamKeySize = 32
+	// streamNonceSuffix is the length of the chunk counter and the last chunk flag in the nonce.
+	streamNonceSuffix = 5
+)
+
+var streamKeyInfo = []byte("cryptowrap stream key") // nolint: gochecknoglobals
+
+// Errors might be returned by the stream encryption.
+var (
+	ErrTruncated        = errors.New("encrypted stream is truncated")
+	ErrInvalidChunkSize = errors.New("invalid chunk size")
+	ErrStreamTooLong    = errors.New("stream is too long")
+	ErrStreamClosed     = errors.New("stream is closed")
+)
+
+// errCutChunk is returned if the chunk read up to the end of the stream could not be authenticated:
+// the stream is cut inside the chunk or the chunk is tampered, these could not be told apart.
+var errCutChunk = fmt.Errorf("%w: %w", ErrTruncated, ErrUndecryptable) // nolint: gochecknoglobals
+
+// streamHeader describes the way the stream was encrypted. It is authenticated with every chunk.
+type streamHeader struct {
+	Version    uint8
+	Cipher     Cipher
+	Flags      uint32
+	ChunkSize  uint32
+	KeyID      []byte
+	WrappedKey []byte
+	Salt       []byte
+}
+
+func (h *streamHeader) marshal() []byte {
+	buf := make([]byte, 0, 14+len(h.KeyID)+len(h.WrappedKey)+len(h.Salt)) // nolint: gomnd
+
+	buf = append(buf, h.Version, byte(h.Cipher))
+	buf = binary.BigEndian.AppendUint32(buf, h.Flags)
+	buf = binary.BigEndian.AppendUint32(buf, h.ChunkSize)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.KeyID)))
+	buf = append(buf, h.KeyID...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(h.WrappedKey)))
+	buf = append(buf, h.WrappedKey...)
+	buf = append(buf, h.Salt...)
+
+	return buf
+}
+
+func readStreamHeader(r io.Reader) (*streamHeader, error) {
+	var fixed [10]byte
+
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, fmt.Errorf("reading stream header: %w", err)
+	}
+
+	h := &streamHeader{
+		Version:   fixed[0],
+		Cipher:    Cipher(fixed[1]),
+		Flags:     binary.BigEndian.Uint32(fixed[2:]),
+		ChunkSize: binary.BigEndian.Uint32(fixed[6:]),
+	}
+
+	if h.Version != versionCurrent {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.Version)
+	}
+
+	if h.ChunkSize == 0 || h.ChunkSize > maxStreamChunkSize {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidChunkSize, h.ChunkSize)
+	}
+
+	var err error
+
+	if h.KeyID, err = readPrefixed(r); err != nil {
+		return nil, err
+	}
+
+	if h.WrappedKey, err = readPrefixed(r); err != nil {
+		return nil, err
+	}
+
+	h.Salt = make([]byte, streamSaltSize)
+
+	if _, err = io.ReadFull(r, h.Salt); err != nil {
+		return nil, fmt.Errorf("reading stream header: %w", err)
+	}
+
+	return h, nil
+}
+
+// readPrefixed reads the bytes prefixed with uint16 length.
+func readPrefixed(r io.Reader) ([]byte, error) {
+	var size [2]byte
+
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, fmt.Errorf("reading stream header: %w", err)
+	}
+
+	buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("reading stream header: %w", err)
+	}
+
+	return buf, nil
+}
+
+// streamCipher is the STREAM construction (Hoang, Reyhanitabar, Rogaway, Vizár "Online Authenticated-Encryption
+// and its Nonce-Reuse Misuse-Resistance"): every chunk is encrypted with AEAD and the nonce
+// made of the per-stream prefix, the chunk counter and the last chunk flag,
+// so chunks could not be reordered, dropped or appended and the truncation is detected.
+type streamCipher struct {
+	aead           cipher.AEAD
+	prefix         []byte
+	additionalData []byte
+}
+
+// newStreamCipher derives the per-stream key and nonce prefix from the key and salt.
+// AEAD ciphers only are supported.
+func newStreamCipher(c Cipher, key, salt, additionalData []byte) (*streamCipher, error) {
+	ivSize, err := c.ivSize()
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.isAEAD() {
+		return nil, fmt.Errorf("%w: %d could not be used for streaming", ErrUnknownCipher, c)
+	}
+
+	derived := make([]byte, streamKeySize+ivSize-streamNonceSuffix)
+
+	if _, err = io.ReadFull(hkdf.New(sha256.New, key, salt, streamKeyInfo), derived); err != nil {
+		return nil, err
+	}
+
+	aead, err := c.aead(derived[:streamKeySize])
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamCipher{aead: aead, prefix: derived[streamKeySize:], additionalData: additionalData}, nil
+}
+
+// streamOverhead returns the length of the authentication tag added to every chunk by the cipher.
+func streamOverhead(c Cipher) (int64, error) {
+	if !c.isAEAD() {
+		return 0, fmt.Errorf("%w: %d could not be used for streaming", ErrUnknownCipher, c)
+	}
+
+	aead, err := c.aead(make([]byte, streamKeySize))
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(aead.Overhead()), nil
+}
+
+func (s *streamCipher) nonce(counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, s.aead.NonceSize())
+	nonce = append(nonce, s.prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+
+	if last {
+		return append(nonce, 1)
+	}
+
+	return append(nonce, 0)
+}
+
+func (s *streamCipher) seal(dst, chunk []byte, counter uint32, last bool) []byte {
+	return s.aead.Seal(dst, s.nonce(counter, last), chunk, s.additionalData)
+}
+
+func (s *streamCipher) open(dst, chunk []byte, counter uint32, last bool) ([]byte, error) {
+	return s.aead.Open(dst, s.nonce(counter, last), chunk, s.additionalData)
+}
+
+// NewEncryptWriter returns the writer encrypting the data written to dst chunk by chunk,
+// so the data of any size could be encrypted with bounded memory.
+//
+// Keys, KeyIDs, KeyRing, KeyProvider, Context, Cipher, KeyHint and AssociatedData of the Wrapper provided are used.
+// Cipher must be AEAD, CBC-based ones are not supported. Payload is not compressed nor padded.
+//
+// Close must be called to write the last chunk, otherwise the stream will be reported truncated.
+// Close does not close dst.
+func NewEncryptWriter(dst io.Writer, w *Wrapper) (io.WriteCloser, error) {
+	return newEncryptWriter(dst, w, 0)
+}
+
+func newEncryptWriter(dst io.Writer, w *Wrapper, flags uint32) (*encryptWriter, error) {
+	h := &streamHeader{
+		Version:   versionCurrent,
+		Cipher:    w.Cipher,
+		Flags:     flags,
+		ChunkSize: streamChunkSize,
+		Salt:      randBytes(streamSaltSize),
+	}
+
+	var (
+		keys *keySet
+		err  error
+	)
+
+	if w.KeyProvider != nil {
+		keys, h.WrappedKey, err = w.newDataKey()
+		h.Flags |= flagWrappedKey
+	} else {
+		keys, err = w.keySet()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !keys.primary {
+		return nil, ErrNoPrimaryKey
+	}
+
+	if w.KeyHint && w.KeyProvider == nil {
+		h.KeyID = keys.id(0)
+	}
+
+	header := h.marshal()
+
+	sc, err := newStreamCipher(h.Cipher, keys.keys[0], h.Salt, append(header, w.AssociatedData...))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = dst.Write(header); err != nil {
+		return nil, fmt.Errorf("writing stream header: %w", err)
+	}
+
+	return &encryptWriter{
+		dst:      dst,
+		cipher:   sc,
+		buf:      make([]byte, 0, h.ChunkSize),
+		seekable: h.Flags&flagSeekable != 0,
+	}, nil
+}
+
+type encryptWriter struct {
+	dst      io.Writer
+	cipher   *streamCipher
+	buf      []byte
+	sealed   []byte
+	counter  uint32
+	seekable bool
+	size     uint64
+	err      error
+}
+
+// Write encrypts and writes the full chunks, the rest is buffered.
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+
+	written := 0
+
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		e.size += uint64(n)
+
+		// the last chunk is always shorter than the chunk size (possibly empty), so the full one could be flushed
+		if len(e.buf) == cap(e.buf) {
+			if e.err = e.flush(false); e.err != nil {
+				return written, e.err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// Close encrypts and writes the last chunk.
+// In case of seekable stream the rest of the data is written as a regular chunk
+// and the last chunk is the trailer containing the data length.
+func (e *encryptWriter) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if e.seekable {
+		if len(e.buf) > 0 {
+			if e.err = e.flush(false); e.err != nil {
+				return e.err
+			}
+		}
+
+		e.buf = binary.BigEndian.AppendUint64(e.buf, e.size)
+	}
+
+	e.err = e.flush(true)
+	if e.err != nil {
+		return e.err
+	}
+
+	e.err = ErrStreamClosed
+
+	return nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	if e.counter == math.MaxUint32 {
+		return ErrStreamTooLong
+	}
+
+	e.sealed = e.cipher.seal(e.sealed[:0], e.buf, e.counter, last)
+	e.buf = e.buf[:0]
+	e.counter++
+
+	if _, err := e.dst.Write(e.sealed); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NewDecryptReader returns the reader decrypting the data encrypted by NewEncryptWriter from src chunk by chunk.
+//
+// Keys, KeyIDs, KeyRing, KeyProvider, Context and AssociatedData of the Wrapper provided are used,
+// KeyIndex and KeyID of it are set to the key used to decrypt the stream.
+// Every chunk is authenticated before it is returned. ErrTruncated is returned
+// if the stream has been truncated, ErrUndecryptable if it has been tampered.
+// The stream cut inside a chunk could not be told from the tampered last chunk,
+// so the error returned matches both ErrTruncated and ErrUndecryptable then
+// (ErrUndecryptable only if the first chunk is cut, as the key could not be found).
+func NewDecryptReader(src io.Reader, w *Wrapper) (io.Reader, error) {
+	h, err := readStreamHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := w.streamKeys(h)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &decryptReader{src: src, seekable: h.Flags&flagSeekable != 0}
+
+	additionalData := append(h.marshal(), w.AssociatedData...)
+
+	for _, i := range keyOrder(len(keys.keys), h.KeyID, keys.id) {
+		sc, err := newStreamCipher(h.Cipher, keys.keys[i], h.Salt, additionalData)
+		if err != nil {
+			return nil, err
+		}
+
+		if d.sealed == nil {
+			if err = d.readFirst(h, sc.aead.Overhead()); err != nil {
+				return nil, err
+			}
+		}
+
+		d.plain, err = sc.open(d.buf, d.sealed, 0, d.last)
+		if err != nil {
+			continue
+		}
+
+		if err = d.accept(); err != nil {
+			return nil, err
+		}
+
+		d.cipher = sc
+		d.counter = 1
+		w.keyIndex = i
+		w.keyID = keys.id(i)
+
+		return d, nil
+	}
+
+	return nil, ErrUndecryptable
+}
+
+// streamKeys returns the keys to try: the data key unwrapped by KeyProvider or the Wrapper keys.
+func (w *Wrapper) streamKeys(h *streamHeader) (*keySet, error) {
+	if h.Flags&flagWrappedKey != 0 {
+		return w.unwrapDataKey(h.WrappedKey)
+	}
+
+	return w.keySet()
+}
+
+type decryptReader struct {
+	src      io.Reader
+	cipher   *streamCipher
+	sealed   []byte
+	buf      []byte
+	plain    []byte
+	counter  uint32
+	last     bool
+	eof      bool
+	seekable bool
+	size     uint64
+	err      error
+
+	// trailerSize bytes of the seekable stream are read ahead to find the trailer.
+	trailerSize int
+	ahead       []byte
+}
+
+// readFirst allocates the buffers for the chunks of the stream and reads the first chunk.
+func (d *decryptReader) readFirst(h *streamHeader, overhead int) error {
+	if d.seekable {
+		d.trailerSize = seekableTrailerSize + overhead
+	}
+
+	d.sealed = make([]byte, int(h.ChunkSize)+overhead+d.trailerSize)
+	d.buf = make([]byte, 0, h.ChunkSize)
+
+	return d.read()
+}
+
+// Read returns the data of the chunks authenticated already and decrypts the next chunk if needed.
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+
+		if d.last {
+			d.err = io.EOF
+
+			continue
+		}
+
+		d.err = d.next()
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	if err := d.read(); err != nil {
+		return err
+	}
+
+	plain, err := d.cipher.open(d.buf, d.sealed, d.counter, d.last)
+	if err != nil {
+		if d.eof {
+			return errCutChunk
+		}
+
+		return ErrUndecryptable
+	}
+
+	d.plain = plain
+	d.counter++
+
+	return d.accept()
+}
+
+// accept checks the chunk decrypted. The last chunk of seekable stream is the trailer:
+// data length is checked and the trailer is not returned.
+func (d *decryptReader) accept() error {
+	if !d.seekable {
+		return nil
+	}
+
+	if !d.last {
+		d.size += uint64(len(d.plain))
+
+		return nil
+	}
+
+	if len(d.plain) != seekableTrailerSize || binary.BigEndian.Uint64(d.plain) != d.size {
+		return ErrUndecryptable
+	}
+
+	d.plain = nil
+
+	return nil
+}
+
+// read reads the next sealed chunk, the short one is the last one.
+func (d *decryptReader) read() error {
+	if d.seekable {
+		return d.readSeekable()
+	}
+
+	d.sealed = d.sealed[:cap(d.sealed)]
+
+	n, err := io.ReadFull(d.src, d.sealed)
+
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		d.last = true
+		d.eof = true
+	case errors.Is(err, io.EOF):
+		return ErrTruncated
+	default:
+		return err
+	}
+
+	d.sealed = d.sealed[:n]
+
+	return nil
+}
+
+// readSeekable reads the next sealed chunk of the seekable stream.
+// The last data chunk could be short as well, so the trailer is found by reading it ahead.
+func (d *decryptReader) readSeekable() error {
+	buf := d.sealed[:cap(d.sealed)]
+	n := copy(buf, d.ahead)
+
+	read, err := io.ReadFull(d.src, buf[n:])
+	n += read
+
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		d.eof = true
+
+		if n < d.trailerSize {
+			return ErrTruncated
+		}
+
+		if n == d.trailerSize {
+			d.last = true
+			d.sealed = buf[:n]
+			d.ahead = d.ahead[:0]
+
+			return nil
+		}
+	default:
+		return err
+	}
+
+	d.ahead = append(d.ahead[:0], buf[n-d.trailerSize:n]...)
+	d.sealed = buf[:n-d.trailerSize]
+
+	return nil
+}
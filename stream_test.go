@@ -0,0 +1,188 @@
+package cryptowrap_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Djarvur/cryptowrap"
+)
+
+const streamChunkSize = 64 << 10
+
+func TestStream(t *testing.T) {
+	keys := [][]byte{randBytes(32), randBytes(32)}
+
+	for _, c := range []cryptowrap.Cipher{
+		cryptowrap.CipherAESGCM,
+		cryptowrap.CipherChaCha20Poly1305,
+		cryptowrap.CipherXChaCha20Poly1305,
+		cryptowrap.CipherAESGCMSIV,
+	} {
+		for _, size := range []int{0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1, 3*streamChunkSize + 5} {
+			plain := randBytes(size)
+			encrypted := encryptStream(t, &cryptowrap.Wrapper{Keys: keys[1:], Cipher: c, KeyHint: true}, plain)
+
+			dst := cryptowrap.Wrapper{Keys: keys}
+
+			r, err := cryptowrap.NewDecryptReader(iotest.HalfReader(bytes.NewReader(encrypted)), &dst)
+			if err != nil {
+				t.Fatalf("cipher %d, size %d: %v", c, size, err)
+			}
+
+			decrypted, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("cipher %d, size %d: %v", c, size, err)
+			}
+
+			if !bytes.Equal(plain, decrypted) || dst.KeyIndex() != 1 {
+				t.Errorf("cipher %d, size %d: decrypted is not equal to original", c, size)
+			}
+		}
+	}
+}
+
+func TestStreamKeyProvider(t *testing.T) {
+	provider, err := cryptowrap.NewMemoryKeyProvider(randBytes(32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := cryptowrap.Wrapper{
+		KeyProvider:    provider,
+		Cipher:         cryptowrap.CipherAESGCM,
+		AssociatedData: []byte("export"),
+	}
+	plain := randBytes(2*streamChunkSize + 100)
+
+	encrypted := encryptStream(t, &src, plain)
+
+	if decrypted, err := decryptStream(&src, encrypted); err != nil || !bytes.Equal(plain, decrypted) {
+		t.Errorf("decrypted is not equal to original: %v", err)
+	}
+
+	_, err = decryptStream(&cryptowrap.Wrapper{KeyProvider: provider}, encrypted)
+	if !errors.Is(err, cryptowrap.ErrUndecryptable) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestStreamTampered(t *testing.T) {
+	src := cryptowrap.Wrapper{Keys: [][]byte{randBytes(16)}, Cipher: cryptowrap.CipherAESGCM}
+	plain := randBytes(2 * streamChunkSize)
+	encrypted := encryptStream(t, &src, plain)
+	headerSize := len(encrypted) - 3*16 - len(plain)
+	sealedChunk := streamChunkSize + 16
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"truncated at chunk boundary", encrypted[:headerSize+2*sealedChunk], cryptowrap.ErrTruncated},
+		{"truncated in the middle", encrypted[:len(encrypted)-1], cryptowrap.ErrUndecryptable},
+		{"truncated inside the last chunk", encrypted[:len(encrypted)-1], cryptowrap.ErrTruncated},
+		{"truncated inside a chunk", encrypted[:headerSize+sealedChunk+100], cryptowrap.ErrTruncated},
+		{"last chunk dropped", encrypted[:headerSize+sealedChunk], cryptowrap.ErrTruncated},
+		{
+			"chunks reordered",
+			concat(encrypted[:headerSize], encrypted[headerSize+sealedChunk:headerSize+2*sealedChunk],
+				encrypted[headerSize:headerSize+sealedChunk], encrypted[headerSize+2*sealedChunk:]),
+			cryptowrap.ErrUndecryptable,
+		},
+		{"appended", concat(encrypted, encrypted[headerSize:headerSize+sealedChunk]), cryptowrap.ErrUndecryptable},
+		{"flipped", flip(encrypted, headerSize+sealedChunk+10), cryptowrap.ErrUndecryptable},
+		{"header flipped", flip(encrypted, 1), cryptowrap.ErrUnknownCipher},
+	}
+
+	for _, test := range tests {
+		_, err := decryptStream(&src, test.data)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestStreamNegative(t *testing.T) {
+	_, err := cryptowrap.NewEncryptWriter(io.Discard, &cryptowrap.Wrapper{Keys: [][]byte{randBytes(16)}})
+	if !errors.Is(err, cryptowrap.ErrUnknownCipher) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err = cryptowrap.NewEncryptWriter(io.Discard, &cryptowrap.Wrapper{Cipher: cryptowrap.CipherAESGCM})
+	if !errors.Is(err, cryptowrap.ErrNoKey) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	w, err := cryptowrap.NewEncryptWriter(io.Discard, &cryptowrap.Wrapper{Keys: [][]byte{randBytes(16)}, Cipher: cryptowrap.CipherAESGCM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.Write([]byte("data")); !errors.Is(err, cryptowrap.ErrStreamClosed) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func encryptStream(t *testing.T, src *cryptowrap.Wrapper, plain []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := cryptowrap.NewEncryptWriter(&buf, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// odd-sized writes to cross the chunk boundaries
+	for p := plain; len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+
+		if _, err = w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+
+		p = p[n:]
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func decryptStream(dst *cryptowrap.Wrapper, data []byte) ([]byte, error) {
+	r, err := cryptowrap.NewDecryptReader(bytes.NewReader(data), dst)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+
+	return out
+}
+
+func flip(data []byte, i int) []byte {
+	out := append([]byte(nil), data...)
+	out[i] ^= 1
+
+	return out
+}
@@ -3,23 +3,27 @@ package cryptowrap
 
 import (
 	"bytes"
-	"crypto/aes"
+	"context"
+	"crypto/hmac"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"hash/crc32"
 	"io/ioutil"
+	"reflect"
+	"time"
 
-	aescrypt "github.com/Djarvur/go-aescrypt"
 	"github.com/pierrec/lz4"
 	"github.com/ugorji/go/codec"
 )
 
 // Errors might be returned. They will be wrapped with stacktrace at least, of course.
 var (
-	ErrUndecryptable = errors.New("data could not be decrypted")
-	ErrNoKey         = errors.New("key has to be provided")
+	ErrUndecryptable    = errors.New("data could not be decrypted")
+	ErrNoKey            = errors.New("key has to be provided")
+	ErrNotDeterministic = errors.New("deterministic mode requires AES-SIV cipher")
+	ErrMapPayload       = errors.New("payload containing maps could not be gob-encoded deterministically")
 )
 
 // Wrapper is a struct with custom JSON/Gob/Binary marshaler and unmarshaler.
@@ -37,16 +41,123 @@ var (
 // ErrUndecryptable will be returned in case no one key is suitable.
 //
 // If Compress is true serialized Payload wil be compressed with LZ4.
+//
+// Cipher selects the encryption algorithm, AES-CBC by default.
+// CipherAESGCM and CipherChaCha20Poly1305 provide authenticated encryption, IV must be 12 bytes long for them.
+// CipherXChaCha20Poly1305 is authenticated as well and requires 24 bytes IV.
+// ChaCha-based ciphers require 32 bytes keys.
+// CipherAESCBCHMAC is AES-CBC authenticated with HMAC-SHA256 (encrypt-then-MAC) for those who have to stay with CBC.
+// CipherAESGCMSIV requires 12 bytes IV as GCM does but reused IV reveals equality of the messages only.
+// Cipher used is stored with the serialized data so Unmarshaler will pick it automatically.
+//
+// Serialized data starts with versioned header describing cipher, compression and format version used.
+// All the ciphers but plain AES-CBC authenticate the header. Header-less data produced by the previous versions is still accepted.
+// If Cipher is authenticated Unmarshaler returns ErrUnauthenticatedData for plain AES-CBC and header-less data
+// before any key tried, so such a data could not be used to probe the keys (e.g. as a padding oracle).
+// Set AllowLegacy to accept it anyway while migrating from plain AES-CBC.
+//
+// If KeyHint is true the key identifier will be stored in the header so Unmarshaler
+// will try the matching keys only instead of all the Keys one by one.
+// Identifiers could be provided in KeyIDs (in the same order as Keys),
+// KeyFingerprint will be used for the keys with no identifier provided.
+//
+// If KeyRing is provided Keys and KeyIDs are ignored: primary key from the ring is used to encrypt the data
+// and all the ring keys but disabled ones are used to decrypt it. Ring key IDs are used as key identifiers.
+//
+// If KeyProvider is provided Keys and KeyRing are ignored: random data key is generated for every message,
+// wrapped by KeyProvider and stored with the serialized data. Unmarshaler unwraps it with KeyProvider.
+// Context is passed to KeyProvider, context.Background() is used if no Context provided.
+//
+// AssociatedData is authenticated but not stored with the serialized data,
+// so Unmarshaler will fail unless the same AssociatedData provided, e.g. the record primary key.
+// Use EncryptionContext to produce it from the key/value context. Plain AES-CBC could not authenticate it.
+//
+// IssuedAt, NotBefore and ExpiresAt timestamps (with one second precision) are stored in the header
+// and authenticated with it, so plain AES-CBC could not be used with them.
+// ExpiresAt could be set as TTL after IssuedAt, IssuedAt is set to the current time if not provided.
+// Unmarshaler will fill the timestamps from the data and return ErrExpired or ErrNotYetValid
+// if the data is out of its validity period. Clock is used to get the current time, time.Now by default.
+//
+// Every serialized data has a random unique identifier. If ReplayGuard is provided
+// Unmarshaler will record the identifier of the data decrypted and return ErrReplay for the data seen before.
+//
+// If Padding is provided serialized (and compressed) Payload will be padded before encryption
+// according to the policy (PadBuckets, PadPowerOfTwo, PadPadme) so the ciphertext length
+// does not leak the payload length. Padding is stripped by Unmarshaler transparently.
+//
+// If Commit is true the ciphertext will be key-committing: it could be decrypted with the only key
+// it has been produced with, so trial decryption with several keys could not succeed with the wrong one.
+// Commitment (HMAC-SHA256 of the key and IV) is stored with the data and verified before decryption.
+// Plain AES-CBC could not be used with it. Unmarshaler with Commit set returns ErrNotCommitted
+// for the data with no commitment before any key tried.
+//
+// If Deterministic is true the same Payload and AssociatedData encrypted with the same key
+// produce the same serialized data, so the encrypted values could be looked up by exact match.
+// CipherAESSIV must be used. Random junk, IV and data identifier are omitted, IV provided is ignored.
+// Equality of the payloads is revealed by design, so use it for the lookup fields only.
+// Data keys generated for KeyProvider and IssuedAt defaulted for TTL are random still.
+// Maps are serialized with the sorted keys by JSON and MsgPack marshalers,
+// Gob randomizes the map order, so GobEncode returns ErrMapPayload for the Payload containing maps.
+//
+// If Convergent is true the data is encrypted deterministically with the content key derived
+// from the serialized Payload with the first key (tenant key), so the same payloads produce the same serialized data
+// and could be deduplicated by the content address (e.g. hash of the serialized data).
+// Content key is stored with the data wrapped deterministically with the tenant key.
+// Tenant key prevents confirmation attacks: the payload could not be guessed without the key.
+// CipherAESSIV must be used, KeyProvider is ignored.
+//
+// If Parallelism is positive serialized Payload is split to ChunkSize (1MiB by default) chunks
+// compressed, padded and encrypted by Parallelism workers concurrently. Chunks are authenticated
+// with their order and count, so AEAD cipher must be used, ErrNotAEAD is returned otherwise.
+// Unmarshaler decrypts such a data with Parallelism workers concurrently,
+// GOMAXPROCS workers are used if Parallelism is not positive.
+//
+// After successful unmarshaling KeyIndex and KeyID report the key has been used to decrypt the data.
+// Stale reports the key used is not the first (primary) one, so the data should be re-encrypted.
 type Wrapper struct {
 	Keys     [][]byte
+	KeyIDs   [][]byte
+	KeyRing  *KeyRing
 	IV       []byte
 	Payload  interface{}
 	Compress bool
+	Cipher   Cipher
+	KeyHint  bool
+
+	AllowLegacy bool
+
+	KeyProvider KeyProvider
+	Context     context.Context
+
+	AssociatedData []byte
+
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+	TTL       time.Duration
+	Clock     func() time.Time
+
+	ReplayGuard ReplayGuard
+
+	Padding PaddingPolicy
+
+	Commit bool
+
+	Deterministic bool
+	Convergent    bool
+
+	Parallelism int
+	ChunkSize   int
+
+	keyIndex int
+	keyID    []byte
 }
 
 type externalWrapper struct {
-	IV      []byte
-	Payload []byte
+	Header     *header
+	WrappedKey []byte
+	IV         []byte
+	Payload    []byte
 }
 
 type internalWrapper struct {
@@ -55,6 +166,10 @@ type internalWrapper struct {
 	Payload    []byte
 }
 
+// junkSize is the length of random junk added to the payload
+// so the same payloads produce unrelated plaintexts.
+const junkSize = 32
+
 type junkWrapper struct {
 	Payload interface{}
 	Junk    []byte
@@ -72,6 +187,10 @@ func (w *Wrapper) UnmarshalJSON(data []byte) error {
 
 // GobEncode is a custom marshaler.
 func (w *Wrapper) GobEncode() ([]byte, error) {
+	if w.deterministic() && hasMap(reflect.ValueOf(w.Payload), map[uintptr]bool{}) {
+		return nil, ErrMapPayload
+	}
+
 	return w.marshal(gobMarshal)
 }
 
@@ -82,6 +201,10 @@ func (w *Wrapper) GobDecode(data []byte) error {
 
 // MarshalBinary is a custom marshaler to be used with MsgPack (github.com/ugorji/go/codec).
 func (w *Wrapper) MarshalBinary() (data []byte, err error) {
+	if w.deterministic() {
+		return w.marshal(binMarshalCanonical)
+	}
+
 	return w.marshal(binMarshal)
 }
 
@@ -91,112 +214,506 @@ func (w *Wrapper) UnmarshalBinary(data []byte) error {
 }
 
 func (w *Wrapper) marshal(marshaler func(interface{}) ([]byte, error)) ([]byte, error) {
-	if len(w.Keys) < 1 {
-		return nil, ErrNoKey
+	junkW := junkWrapper{
+		Payload: w.Payload,
+	}
+
+	if !w.deterministic() {
+		junkW.Junk = randBytes(junkSize)
+	}
+
+	payload, err := marshaler(&junkW)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	return w.seal(payload, nil, marshaler)
+}
+
+func (w *Wrapper) unmarshal(data []byte, unmarshaler func([]byte, interface{}) error) error {
+	payload, _, err := w.open(data, unmarshaler)
+	if err != nil {
+		return err
+	}
+
+	junkW := junkWrapper{
+		Payload: w.Payload,
+	}
+
+	err = unmarshaler(payload, &junkW)
+	if err != nil {
+		return fmt.Errorf("unmarshaling wrapper: %w", err)
+	}
+
+	w.Payload = junkW.Payload
+
+	return nil
+}
+
+// seal compresses and encrypts the serialized payload and serializes the result.
+// Timestamps and identifier of the original header are kept if provided, so re-encrypted data is valid
+// no longer than the original one and could not be replayed once more.
+func (w *Wrapper) seal(payload []byte, orig *header, marshaler func(interface{}) ([]byte, error)) ([]byte, error) {
+	h, err := w.newHeader(orig)
+	if err != nil {
+		return nil, err
+	}
+
+	extW := externalWrapper{Header: h}
+
+	key, err := w.sealKey(h, &extW, payload)
+	if err != nil {
+		return nil, err
 	}
 
+	extW.IV, err = w.sealIV()
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Flags&flagChunked != 0 {
+		extW.Payload, err = w.sealChunks(h, payload, key, extW.IV, marshaler)
+	} else {
+		extW.Payload, err = w.sealPayload(h, payload, key, extW.IV, marshaler)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := marshaler(&extW)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling: %w", err)
+	}
+
+	return data, err
+}
+
+// newHeader returns the header for the data to be sealed with the Wrapper settings.
+func (w *Wrapper) newHeader(orig *header) (*header, error) {
+	flags, err := w.headerFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &header{
+		Version:     versionCurrent,
+		Cipher:      w.Cipher,
+		Compression: compression(w.Compress),
+		Flags:       flags,
+	}
+
+	if !w.deterministic() {
+		h.ID = randBytes(envelopeIDSize)
+	}
+
+	if err = checkAssociatedData(w.Cipher, w.AssociatedData); err != nil {
+		return nil, err
+	}
+
+	w.stampFrom(h, orig)
+
+	if h.timestamped() && !w.Cipher.authenticated() {
+		return nil, ErrNotAuthenticated
+	}
+
+	return h, nil
+}
+
+// headerFlags returns the header flags for the Wrapper settings checking they are supported by the Cipher.
+func (w *Wrapper) headerFlags() (uint32, error) {
+	var flags uint32
+
+	if w.deterministic() {
+		if w.Cipher != CipherAESSIV {
+			return 0, ErrNotDeterministic
+		}
+
+		flags |= flagDeterministic
+	}
+
+	if w.Padding != nil {
+		flags |= flagPadded
+	}
+
+	if w.Parallelism > 0 {
+		if !w.Cipher.isAEAD() {
+			return 0, ErrNotAEAD
+		}
+
+		flags |= flagChunked
+	}
+
+	if w.Commit {
+		if !w.Cipher.authenticated() {
+			return 0, ErrNotAuthenticated
+		}
+
+		flags |= flagCommitted
+	}
+
+	return flags, nil
+}
+
+// stampFrom sets the header timestamps and identifier from the original header if provided,
+// timestamps are set from the Wrapper settings otherwise.
+func (w *Wrapper) stampFrom(h *header, orig *header) {
+	if orig != nil && orig.timestamped() {
+		h.IssuedAt, h.NotBefore, h.ExpiresAt = orig.IssuedAt, orig.NotBefore, orig.ExpiresAt
+	} else {
+		w.stamp(h)
+	}
+
+	if orig != nil && len(orig.ID) > 0 {
+		h.ID = orig.ID
+	}
+}
+
+// sealKey returns the key the data to be encrypted with,
+// the wrapped data key or the content key is stored to the external wrapper.
+func (w *Wrapper) sealKey(h *header, extW *externalWrapper, payload []byte) ([]byte, error) {
+	keys, err := w.sealKeys(h, extW)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.validate(); err != nil {
+		return nil, err
+	}
+
+	key := keys.keys[0]
+
+	if !w.Convergent {
+		return key, nil
+	}
+
+	h.Flags |= flagConvergent
+
+	key, extW.WrappedKey, err = convergentKey(key, payload, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// sealKeys returns the key set with the primary key to encrypt the data with:
+// the new data key wrapped by KeyProvider or the Wrapper keys.
+func (w *Wrapper) sealKeys(h *header, extW *externalWrapper) (*keySet, error) {
 	var (
-		intW  internalWrapper
-		junkW junkWrapper
-		extW  externalWrapper
-		err   error
+		keys *keySet
+		err  error
 	)
 
-	if w.IV == nil {
-		w.IV = randBytes(aes.BlockSize)
+	if w.KeyProvider != nil && !w.Convergent {
+		keys, extW.WrappedKey, err = w.newDataKey()
+		h.Flags |= flagWrappedKey
+	} else {
+		keys, err = w.keySet()
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
-	junkW.Payload = w.Payload
-	junkW.Junk = randBytes(len(w.Keys[0]))
+	if !keys.primary {
+		return nil, ErrNoPrimaryKey
+	}
+
+	if w.KeyHint && h.Flags&flagWrappedKey == 0 {
+		h.KeyID = keys.id(0)
+	}
 
-	intW.Payload, err = marshaler(&junkW)
+	return keys, nil
+}
+
+// sealIV returns the IV the data to be encrypted with: none for deterministic encryption,
+// the one provided or the random one.
+func (w *Wrapper) sealIV() ([]byte, error) {
+	ivSize, err := w.Cipher.ivSize()
 	if err != nil {
-		return nil, fmt.Errorf("marshaling payload: %w", err)
+		return nil, err
 	}
 
+	switch {
+	case w.deterministic():
+		return nil, nil
+	case w.IV != nil:
+		return w.IV, nil
+	default:
+		return randBytes(ivSize), nil
+	}
+}
+
+// sealPayload compresses, pads and encrypts the serialized payload as a whole.
+func (w *Wrapper) sealPayload(
+	h *header,
+	payload, key, iv []byte,
+	marshaler func(interface{}) ([]byte, error),
+) ([]byte, error) {
+	var (
+		intW internalWrapper
+		err  error
+	)
+
+	intW.Payload = payload
+
 	if w.Compress {
 		intW.Payload, err = compress(intW.Payload)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		intW.Compressed = true
+	if w.Padding != nil {
+		intW.Payload = pad(intW.Payload, w.Padding)
 	}
 
-	intW.Checksum = crc32.ChecksumIEEE(intW.Payload)
+	intW.Checksum = checksum(h, intW.Payload)
 
-	extW.Payload, err = marshaler(&intW)
+	data, err := marshaler(&intW)
 	if err != nil {
 		return nil, fmt.Errorf("marshaling payload wrapper: %w", err)
 	}
 
-	extW.IV = w.IV
-
-	extW.Payload, err = aescrypt.EncryptAESCBCPadded(extW.Payload, w.Keys[0], w.IV)
+	data, err = h.encrypt(data, key, iv, w.AssociatedData)
 	if err != nil {
 		return nil, fmt.Errorf("encrypting: %w", err)
 	}
 
-	data, err := marshaler(&extW)
-	if err != nil {
-		return nil, fmt.Errorf("marshaling: %w", err)
-	}
-
-	return data, err
+	return data, nil
 }
 
-func (w *Wrapper) unmarshal(data []byte, unmarshaler func([]byte, interface{}) error) error {
-	if len(w.Keys) < 1 {
-		return ErrNoKey
+// open decrypts and decompresses the serialized payload.
+func (w *Wrapper) open(data []byte, unmarshaler func([]byte, interface{}) error) ([]byte, *header, error) {
+	if !w.hasKeys() {
+		return nil, nil, ErrNoKey
 	}
 
 	extW := externalWrapper{}
 
 	err := unmarshaler(data, &extW)
 	if err != nil {
-		return fmt.Errorf("unmarshaling: %w", err)
+		return nil, nil, fmt.Errorf("unmarshaling: %w", err)
 	}
 
-	for _, key := range w.Keys {
-		data, err = aescrypt.DecryptAESCBCPadded(extW.Payload, key, extW.IV)
-		if err != nil {
+	h, err := w.openHeader(extW.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := w.openKeys(h, &extW)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, i := range keyOrder(len(keys.keys), h.KeyID, keys.id) {
+		payload, err := w.openWithKey(h, &extW, keys.keys[i], unmarshaler)
+		if errors.Is(err, ErrUndecryptable) {
 			continue
 		}
 
-		intW := internalWrapper{}
-
-		err = unmarshaler(data, &intW)
 		if err != nil {
-			continue
+			return nil, nil, err
 		}
 
-		checksum := crc32.ChecksumIEEE(intW.Payload)
-		if checksum != intW.Checksum {
-			continue
+		if err = w.checkValidity(h); err != nil {
+			return nil, nil, err
 		}
 
-		if intW.Compressed {
-			intW.Payload, err = decompress(intW.Payload)
-			if err != nil {
-				return err
-			}
+		w.keyIndex = i
+		w.keyID = keys.id(i)
+
+		return payload, h, nil
+	}
+
+	return nil, nil, ErrUndecryptable
+}
+
+// hasKeys reports whether the Wrapper has any key source.
+func (w *Wrapper) hasKeys() bool {
+	return len(w.Keys) > 0 || w.KeyRing != nil || w.KeyProvider != nil
+}
+
+// openHeader returns the header of the data to be opened, legacy one for the header-less data,
+// checking it is acceptable for the Wrapper settings.
+func (w *Wrapper) openHeader(h *header) (*header, error) {
+	if h == nil {
+		h = legacyHeader(CipherAESCBC)
+	}
+
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := w.acceptHeader(h); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.Cipher.ivSize(); err != nil {
+		return nil, err
+	}
+
+	if err := checkAssociatedData(h.Cipher, w.AssociatedData); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// acceptHeader checks the data is protected as the Wrapper requires:
+// authenticated if the Wrapper Cipher is authenticated (unless AllowLegacy) and key-committing if Commit is set.
+func (w *Wrapper) acceptHeader(h *header) error {
+	if w.Cipher.authenticated() && !h.Cipher.authenticated() && !w.AllowLegacy {
+		return ErrUnauthenticatedData
+	}
+
+	if w.Commit && h.Flags&flagCommitted == 0 {
+		return ErrNotCommitted
+	}
+
+	return nil
+}
+
+// openKeys returns the keys to try: the data key unwrapped by KeyProvider or the Wrapper keys.
+func (w *Wrapper) openKeys(h *header, extW *externalWrapper) (*keySet, error) {
+	if h.Flags&flagWrappedKey != 0 {
+		return w.unwrapDataKey(extW.WrappedKey)
+	}
+
+	return w.keySet()
+}
+
+// openWithKey decrypts and decompresses the serialized payload with the key provided.
+// ErrUndecryptable is returned if the key is not suitable.
+func (w *Wrapper) openWithKey(
+	h *header,
+	extW *externalWrapper,
+	key []byte,
+	unmarshaler func([]byte, interface{}) error,
+) ([]byte, error) {
+	var (
+		dataKey = key
+		payload []byte
+		err     error
+	)
+
+	if h.Flags&flagConvergent != 0 {
+		dataKey, err = unwrapContentKey(key, extW.WrappedKey, h)
+		if err != nil {
+			return nil, ErrUndecryptable
 		}
+	}
+
+	if h.Flags&flagChunked != 0 {
+		payload, err = w.openChunks(h, extW, dataKey, unmarshaler)
+	} else {
+		payload, err = w.openPayload(h, extW, dataKey, unmarshaler)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Flags&flagConvergent != 0 && !hmac.Equal(dataKey, contentKey(key, payload)) {
+		return nil, ErrUndecryptable
+	}
+
+	return payload, nil
+}
+
+// checkValidity checks the data decrypted is within its validity period and is not replayed.
+func (w *Wrapper) checkValidity(h *header) error {
+	if err := w.checkTimestamps(h); err != nil {
+		return err
+	}
+
+	return w.checkReplay(h)
+}
 
-		junkW := junkWrapper{
-			Payload: w.Payload,
+// openPayload decrypts, unpads and decompresses the serialized payload encrypted as a whole.
+// ErrUndecryptable is returned if the key is not suitable.
+func (w *Wrapper) openPayload(
+	h *header,
+	extW *externalWrapper,
+	key []byte,
+	unmarshaler func([]byte, interface{}) error,
+) ([]byte, error) {
+	data, err := h.decrypt(extW.Payload, key, extW.IV, w.AssociatedData)
+	if err != nil {
+		return nil, ErrUndecryptable
+	}
+
+	intW := internalWrapper{}
+
+	err = unmarshaler(data, &intW)
+	if err != nil {
+		return nil, ErrUndecryptable
+	}
+
+	if checksum(h, intW.Payload) != intW.Checksum {
+		return nil, ErrUndecryptable
+	}
+
+	if h.Flags&flagPadded != 0 {
+		intW.Payload, err = unpad(intW.Payload)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		err = unmarshaler(intW.Payload, &junkW)
+	if intW.Compressed || h.Compression == CompressionLZ4 {
+		intW.Payload, err = decompress(intW.Payload)
 		if err != nil {
-			return fmt.Errorf("unmarshaling wrapper: %w", err)
+			return nil, err
 		}
+	}
 
-		w.Payload = junkW.Payload
+	return intW.Payload, nil
+}
+
+// KeyIndex returns the index of the key in Keys used to decrypt the data by the last unmarshaling.
+// In case of KeyRing used it is an index in the list of the ring keys, primary one first.
+func (w *Wrapper) KeyIndex() int {
+	return w.keyIndex
+}
+
+// KeyID returns the identifier of the key used to decrypt the data by the last unmarshaling.
+func (w *Wrapper) KeyID() []byte {
+	return w.keyID
+}
+
+// Stale returns true if the data has been decrypted by the last unmarshaling with the key other than the first one.
+// Such a data should be re-encrypted with the actual key.
+func (w *Wrapper) Stale() bool {
+	return w.keyIndex > 0
+}
+
+// keySet returns the keys to be used: from KeyRing if provided, Keys and KeyIDs otherwise.
+func (w *Wrapper) keySet() (*keySet, error) {
+	return symmetricKeys(w.Keys, w.KeyIDs, w.KeyRing)
+}
 
-		return nil
+// symmetricKeys returns the keys from the ring if provided or the keys and identifiers provided otherwise.
+func symmetricKeys(keys, ids [][]byte, ring *KeyRing) (*keySet, error) {
+	var set *keySet
+
+	if ring != nil {
+		set = ring.symmetric()
+	} else {
+		set = &keySet{keys: keys, ids: ids, primary: true}
+	}
+
+	if len(set.keys) < 1 {
+		return nil, ErrNoKey
 	}
 
-	return ErrUndecryptable
+	return set, nil
+}
+
+// checksum calculates the checksum of the payload and the header.
+func checksum(h *header, payload []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(h.additionalData()), crc32.IEEETable, payload)
 }
 
 func compress(data []byte) ([]byte, error) {
@@ -243,9 +760,21 @@ func gobUnmarshal(data []byte, e interface{}) error {
 }
 
 func binMarshal(e interface{}) ([]byte, error) {
+	return binEncode(e, new(codec.MsgpackHandle))
+}
+
+// binMarshalCanonical serializes the maps with the sorted keys, so the result is deterministic.
+func binMarshalCanonical(e interface{}) ([]byte, error) {
+	h := new(codec.MsgpackHandle)
+	h.Canonical = true
+
+	return binEncode(e, h)
+}
+
+func binEncode(e interface{}, h *codec.MsgpackHandle) ([]byte, error) {
 	var b bytes.Buffer
 
-	if err := codec.NewEncoder(&b, new(codec.MsgpackHandle)).Encode(e); err != nil {
+	if err := codec.NewEncoder(&b, h).Encode(e); err != nil {
 		return nil, err
 	}
 
@@ -255,3 +784,48 @@ func binMarshal(e interface{}) ([]byte, error) {
 func binUnmarshal(data []byte, e interface{}) error {
 	return codec.NewDecoderBytes(data, new(codec.MsgpackHandle)).Decode(e)
 }
+
+// hasMap reports the value contains a map. Pointers visited are skipped to handle the cycles.
+func hasMap(v reflect.Value, visited map[uintptr]bool) bool {
+	switch v.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Ptr:
+		if v.IsNil() || visited[v.Pointer()] {
+			return false
+		}
+
+		visited[v.Pointer()] = true
+
+		return hasMap(v.Elem(), visited)
+	case reflect.Interface:
+		return !v.IsNil() && hasMap(v.Elem(), visited)
+	case reflect.Struct:
+		return anyHasMap(v.NumField(), v.Field, visited)
+	case reflect.Slice, reflect.Array:
+		return !scalar(v.Type().Elem().Kind()) && anyHasMap(v.Len(), v.Index, visited)
+	default:
+		return false
+	}
+}
+
+// anyHasMap reports any of n values returned by value contains a map.
+func anyHasMap(n int, value func(int) reflect.Value, visited map[uintptr]bool) bool {
+	for i := 0; i < n; i++ {
+		if hasMap(value(i), visited) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scalar reports the values of the kind could not contain maps.
+func scalar(k reflect.Kind) bool {
+	switch k {
+	case reflect.Map, reflect.Ptr, reflect.Interface, reflect.Struct, reflect.Slice, reflect.Array:
+		return false
+	default:
+		return true
+	}
+}
@@ -2,6 +2,7 @@
 package cryptowrap
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -12,32 +13,67 @@ import (
 
 // WrapperRSA is a struct with custom JSON/Gob/Binary marshaler and unmarshaler.
 //
-// Marshaler will encrypt Payload with RSA using EncKey as a public key.
+// Marshaler will encrypt Payload with AES-256-GCM using random data key,
+// and the data key will be encrypted with RSA-OAEP using EncKey as a public key
 // and hash function provided in Hash.
 // sha256.New() will be used if no Hash provided.
 //
+// To send the same data to several recipients provide their public keys in EncKeys:
+// Payload will be encrypted once and the data key will be encrypted for EncKey and every key in EncKeys.
+// Any of the recipients could decrypt the data with its private key.
+//
+// If KeyHint is true PublicKeyFingerprint of the recipient keys will be stored with the data
+// so Unmarshaler will try the matching keys only.
+//
+// If KeyRing is provided DecKeys are ignored and the ring RSA keys (but disabled ones) are used to decrypt the data,
+// primary one first. Public part of the ring primary key is used as EncKey if no EncKey provided.
+//
+// AssociatedData is authenticated but not stored with the serialized data,
+// so Unmarshaler will fail unless the same AssociatedData provided. See Wrapper for details.
+//
+// After successful unmarshaling KeyIndex and KeyID report the key has been used to decrypt the data.
+// Stale reports the key used is not the first (primary) one, so the data should be re-encrypted.
+//
 // Unmarshaler will decrypt Payload with the DecKeys provided.
-// Keys will be tryied one by one until success decryption.
+// Keys will be tryied one by one against every recipient until success decryption.
 // ErrUndecryptable will be returned in case no one key is suitable.
 //
 // Label must be the same for Marshaling and Umarshaling. If no label provided empty one is used.
 //
 // If Compress is true serialized Payload wil be compressed with LZ4.
 //
-// Note: there is a limit for the length of data could be encrypted with RSA:
-// The message must be no longer than the length of the public modulus minus twice the hash length, minus a further 2.
-// See https://golang.org/pkg/crypto/rsa/#EncryptOAEP for details (there no much though).
+// Serialized data starts with versioned header, authenticated as a part of the OAEP label and by AES-GCM.
+// Header-less data produced by the previous versions is still accepted.
+//
+// There is no limit for the payload length as only the data key is encrypted with RSA.
+// Data produced by the previous versions (payload encrypted with RSA-OAEP directly) is still accepted.
 type WrapperRSA struct {
 	DecKeys  []*rsa.PrivateKey
 	EncKey   *rsa.PublicKey
+	EncKeys  []*rsa.PublicKey
+	KeyRing  *KeyRing
 	Hash     hash.Hash
 	Label    []byte
 	Payload  interface{}
 	Compress bool
+	KeyHint  bool
+
+	AssociatedData []byte
+
+	keyIndex int
+	keyID    []byte
 }
 
 type externalWrapperRSA struct {
-	Payload []byte
+	Header     *header
+	Recipients []recipientRSA
+	IV         []byte
+	Payload    []byte
+}
+
+type recipientRSA struct {
+	KeyID []byte
+	Key   []byte
 }
 
 type internalWrapperRSA struct {
@@ -45,6 +81,12 @@ type internalWrapperRSA struct {
 	Payload    []byte
 }
 
+// dataCipherRSA is used by WrapperRSA to encrypt payload with the data key.
+const dataCipherRSA = CipherAESGCM
+
+// dataKeySizeRSA is the length of the data key generated by WrapperRSA.
+const dataKeySizeRSA = 32
+
 // MarshalJSON is a custom marshaler.
 func (w *WrapperRSA) MarshalJSON() ([]byte, error) {
 	return w.marshal(json.Marshal)
@@ -78,6 +120,30 @@ func (w *WrapperRSA) UnmarshalBinary(data []byte) error {
 var emptyLabel = []byte("") // nolint: gochecknoglobals
 
 func (w *WrapperRSA) marshal(marshaler func(interface{}) ([]byte, error)) ([]byte, error) {
+	payload, err := marshaler(w.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	return w.seal(payload, marshaler)
+}
+
+func (w *WrapperRSA) unmarshal(data []byte, unmarshaler func([]byte, interface{}) error) error {
+	payload, err := w.open(data, unmarshaler)
+	if err != nil {
+		return err
+	}
+
+	err = unmarshaler(payload, w.Payload)
+	if err != nil {
+		return fmt.Errorf("unmarshaling wrapper: %w", err)
+	}
+
+	return nil
+}
+
+// seal compresses and encrypts the serialized payload and serializes the result.
+func (w *WrapperRSA) seal(payload []byte, marshaler func(interface{}) ([]byte, error)) ([]byte, error) {
 	var (
 		intW internalWrapperRSA
 		extW externalWrapperRSA
@@ -92,18 +158,19 @@ func (w *WrapperRSA) marshal(marshaler func(interface{}) ([]byte, error)) ([]byt
 		w.Label = emptyLabel
 	}
 
-	intW.Payload, err = marshaler(w.Payload)
-	if err != nil {
-		return nil, fmt.Errorf("marshaling payload: %w", err)
+	h := &header{
+		Version:     versionCurrent,
+		Cipher:      dataCipherRSA,
+		Compression: compression(w.Compress),
 	}
 
+	intW.Payload = payload
+
 	if w.Compress {
 		intW.Payload, err = compress(intW.Payload)
 		if err != nil {
 			return nil, err
 		}
-
-		intW.Compressed = true
 	}
 
 	extW.Payload, err = marshaler(&intW)
@@ -111,11 +178,26 @@ func (w *WrapperRSA) marshal(marshaler func(interface{}) ([]byte, error)) ([]byt
 		return nil, fmt.Errorf("marshaling payload wrapper: %w", err)
 	}
 
-	extW.Payload, err = rsa.EncryptOAEP(w.Hash, rand.Reader, w.EncKey, extW.Payload, w.Label)
+	ivSize, err := h.Cipher.ivSize()
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := randBytes(dataKeySizeRSA)
+
+	extW.Header = h
+	extW.IV = randBytes(ivSize)
+
+	extW.Payload, err = h.encrypt(extW.Payload, dataKey, extW.IV, w.AssociatedData)
 	if err != nil {
 		return nil, fmt.Errorf("encrypting: %w", err)
 	}
 
+	extW.Recipients, err = w.recipients(dataKey, h.bind(w.Label))
+	if err != nil {
+		return nil, err
+	}
+
 	data, err := marshaler(&extW)
 	if err != nil {
 		return nil, fmt.Errorf("marshaling: %w", err)
@@ -124,9 +206,15 @@ func (w *WrapperRSA) marshal(marshaler func(interface{}) ([]byte, error)) ([]byt
 	return data, err
 }
 
-func (w *WrapperRSA) unmarshal(data []byte, unmarshaler func([]byte, interface{}) error) error { // nolint: gocyclo
-	if len(w.DecKeys) < 1 {
-		return ErrNoKey
+// open decrypts and decompresses the serialized payload.
+func (w *WrapperRSA) open(data []byte, unmarshaler func([]byte, interface{}) error) ([]byte, error) { // nolint: gocyclo
+	decKeys := w.DecKeys
+	if w.KeyRing != nil {
+		decKeys, _ = w.KeyRing.private()
+	}
+
+	if len(decKeys) < 1 {
+		return nil, ErrNoKey
 	}
 
 	if w.Hash == nil {
@@ -137,40 +225,138 @@ func (w *WrapperRSA) unmarshal(data []byte, unmarshaler func([]byte, interface{}
 		w.Label = emptyLabel
 	}
 
-	extW := externalWrapper{}
+	extW := externalWrapperRSA{}
 
 	err := unmarshaler(data, &extW)
 	if err != nil {
-		return fmt.Errorf("unmarshaling: %w", err)
+		return nil, fmt.Errorf("unmarshaling: %w", err)
 	}
 
-	for _, key := range w.DecKeys {
-		data, err = rsa.DecryptOAEP(w.Hash, rand.Reader, key, extW.Payload, w.Label)
+	h := extW.Header
+	if h == nil {
+		h = legacyHeader(cipherRSAOAEP)
+	}
+
+	if err = h.validate(); err != nil {
+		return nil, err
+	}
+
+	if h.Cipher != cipherRSAOAEP {
+		if _, err = h.Cipher.ivSize(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = checkAssociatedData(h.Cipher, w.AssociatedData); err != nil {
+		return nil, err
+	}
+
+	for i, key := range decKeys {
+		data, err = w.decrypt(&extW, h, key)
 		if err != nil {
 			continue
 		}
 
-		intW := internalWrapper{}
+		intW := internalWrapperRSA{}
 
 		err = unmarshaler(data, &intW)
 		if err != nil {
 			continue
 		}
 
-		if intW.Compressed {
+		if intW.Compressed || h.Compression == CompressionLZ4 {
 			intW.Payload, err = decompress(intW.Payload)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 
-		err = unmarshaler(intW.Payload, w.Payload)
+		w.keyIndex = i
+		w.keyID = PublicKeyFingerprint(&key.PublicKey)
+
+		return intW.Payload, nil
+	}
+
+	return nil, ErrUndecryptable
+}
+
+// KeyIndex returns the index of the key in DecKeys used to decrypt the data by the last unmarshaling.
+// In case of KeyRing used it is an index in the list of the ring RSA keys, primary one first.
+func (w *WrapperRSA) KeyIndex() int {
+	return w.keyIndex
+}
+
+// KeyID returns PublicKeyFingerprint of the key used to decrypt the data by the last unmarshaling.
+func (w *WrapperRSA) KeyID() []byte {
+	return w.keyID
+}
+
+// Stale returns true if the data has been decrypted by the last unmarshaling with the key other than the first one.
+// Such a data should be re-encrypted with the actual key.
+func (w *WrapperRSA) Stale() bool {
+	return w.keyIndex > 0
+}
+
+// decrypt decrypts the payload with the private key provided.
+// Payload is encrypted with RSA-OAEP directly in the previous versions format
+// and with the data key encrypted with RSA-OAEP in the current one.
+func (w *WrapperRSA) decrypt(extW *externalWrapperRSA, h *header, key *rsa.PrivateKey) ([]byte, error) {
+	if h.Cipher == cipherRSAOAEP {
+		return rsa.DecryptOAEP(w.Hash, rand.Reader, key, extW.Payload, h.bind(w.Label))
+	}
+
+	keyID := PublicKeyFingerprint(&key.PublicKey)
+
+	for _, r := range extW.Recipients {
+		if len(r.KeyID) > 0 && !bytes.Equal(r.KeyID, keyID) {
+			continue
+		}
+
+		dataKey, err := rsa.DecryptOAEP(w.Hash, rand.Reader, key, r.Key, h.bind(w.Label))
 		if err != nil {
-			return fmt.Errorf("unmarshaling wrapper: %w", err)
+			continue
+		}
+
+		return h.decrypt(extW.Payload, dataKey, extW.IV, w.AssociatedData)
+	}
+
+	return nil, ErrUndecryptable
+}
+
+// recipients encrypts the data key for EncKey (or KeyRing primary key) and every key in EncKeys.
+func (w *WrapperRSA) recipients(dataKey []byte, label []byte) ([]recipientRSA, error) {
+	encKey := w.EncKey
+	if encKey == nil && w.KeyRing != nil {
+		if ringKeys, primary := w.KeyRing.private(); primary {
+			encKey = &ringKeys[0].PublicKey
+		}
+	}
+
+	keys := w.EncKeys
+	if encKey != nil {
+		keys = append([]*rsa.PublicKey{encKey}, keys...)
+	}
+
+	if len(keys) < 1 {
+		return nil, ErrNoKey
+	}
+
+	recipients := make([]recipientRSA, 0, len(keys))
+
+	for _, key := range keys {
+		encrypted, err := rsa.EncryptOAEP(w.Hash, rand.Reader, key, dataKey, label)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting data key: %w", err)
+		}
+
+		r := recipientRSA{Key: encrypted}
+
+		if w.KeyHint {
+			r.KeyID = PublicKeyFingerprint(key)
 		}
 
-		return nil
+		recipients = append(recipients, r)
 	}
 
-	return ErrUndecryptable
+	return recipients, nil
 }
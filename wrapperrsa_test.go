@@ -1,9 +1,11 @@
 package cryptowrap_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"sync"
 	"testing"
@@ -35,6 +37,10 @@ func testKeysInit() {
 	}
 }
 
+func TestWrapperRSAJSON2048(t *testing.T) {
+	testWrapperRSA(t, testKeys2048, false, json.Marshal, json.Unmarshal)
+}
+
 func TestWrapperRSAJSON4096(t *testing.T) {
 	testWrapperRSA(t, testKeys4096, false, json.Marshal, json.Unmarshal)
 }
@@ -162,6 +168,90 @@ func testWrapperRSA(
 	}
 }
 
+func TestWrapperRSALargePayload(t *testing.T) {
+	initKeys.Do(testKeysInit)
+
+	orig := TestData{
+		Field1: string(bytes.Repeat([]byte("Field1"), 10000)),
+		Field2: "Field2",
+	}
+
+	data, err := json.Marshal(&cryptowrap.WrapperRSA{EncKey: &testKeys2048[0].PublicKey, Payload: &orig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := cryptowrap.WrapperRSA{
+		DecKeys: testKeys2048,
+		Payload: &TestData{},
+	}
+
+	err = json.Unmarshal(data, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(&orig, dst.Payload) {
+		t.Error("decrypted is not equal to original")
+	}
+}
+
+func TestWrapperRSAMultiRecipientJSON(t *testing.T) {
+	testWrapperRSAMultiRecipient(t, json.Marshal, json.Unmarshal)
+}
+
+func TestWrapperRSAMultiRecipientMsgp(t *testing.T) {
+	testWrapperRSAMultiRecipient(t, binMarshal, binUnmarshal)
+}
+
+func testWrapperRSAMultiRecipient(
+	t *testing.T,
+	marshaler func(interface{}) ([]byte, error),
+	unmarshaler func([]byte, interface{}) error,
+) {
+	initKeys.Do(testKeysInit)
+
+	orig := TestData{
+		Field1: "Field1",
+		Field2: "Field2",
+	}
+
+	data, err := marshaler(&cryptowrap.WrapperRSA{
+		EncKey:  &testKeys2048[0].PublicKey,
+		EncKeys: []*rsa.PublicKey{&testKeys2048[1].PublicKey, &testKeys4096[0].PublicKey},
+		Payload: &orig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []*rsa.PrivateKey{testKeys2048[0], testKeys2048[1], testKeys4096[0]} {
+		dst := cryptowrap.WrapperRSA{
+			DecKeys: []*rsa.PrivateKey{key},
+			Payload: &TestData{},
+		}
+
+		err = unmarshaler(data, &dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(&orig, dst.Payload) {
+			t.Error("decrypted is not equal to original")
+		}
+	}
+
+	err = unmarshaler(data, &cryptowrap.WrapperRSA{DecKeys: testKeys4096[1:], Payload: &TestData{}})
+	if err == nil {
+		t.Error("decrypted undecryptable")
+	}
+
+	_, err = marshaler(&cryptowrap.WrapperRSA{Payload: &orig})
+	if !errors.Is(err, cryptowrap.ErrNoKey) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestWrapperRSAJSONNegative(t *testing.T) {
 	testWrapperRSANegative(t, json.Marshal, json.Unmarshal)
 }